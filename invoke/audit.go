@@ -0,0 +1,109 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// AuditRecord is the record written to the ledger by the AuditTrail middleware.
+type AuditRecord struct {
+	TxID      string    `json:"txId"`
+	Function  string    `json:"function"`
+	Creator   string    `json:"creator"`
+	Timestamp time.Time `json:"timestamp"`
+	ArgsHash  string    `json:"argsHash"`
+	Status    int32     `json:"status"`
+}
+
+// AuditTrail creates a middleware that writes an AuditRecord to the ledger
+// under keyPrefix + txID after each successful invoke. The creator is
+// identified by GetCreatorIDHash, the timestamp is the transaction timestamp,
+// and the arguments are hashed rather than stored. Failed invokes are not
+// audited, as Fabric does not commit failed transactions, so any record written
+// would be discarded.
+func AuditTrail(keyPrefix string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// call next handler
+		rsp := next(stub, args)
+		if rsp.Status >= shim.ERRORTHRESHOLD {
+			return rsp
+		}
+
+		// build the audit record
+		function, _ := stub.GetFunctionAndParameters()
+		record := AuditRecord{TxID: stub.GetTxID(), Function: function, Status: rsp.Status}
+		var err error
+		if record.Creator, err = GetCreatorIDHash(stub); err != nil {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting creator for audit record: %s", err.Error()))
+		}
+		if record.Timestamp, err = DeterministicNow(stub); err != nil {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting timestamp for audit record: %s", err.Error()))
+		}
+		if record.ArgsHash, err = hashInvokeArgs(function, args); err != nil {
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error hashing arguments: %s", err.Error()))
+		}
+
+		// write the audit record
+		if _, err = PutJSON(stub, keyPrefix+record.TxID, record); err != nil {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error storing audit record: %s", err.Error()))
+		}
+
+		return rsp
+	}
+}
+
+// GetAuditRecords gets the audit records written by AuditTrail under keyPrefix
+// with a timestamp in the range [from, to). A zero from or to leaves that end
+// of the range open. Records are returned in key order, which is the order of
+// their transaction IDs rather than their timestamps.
+func GetAuditRecords(stub shim.ChaincodeStubInterface, keyPrefix string, from, to time.Time) ([]AuditRecord, error) {
+	it, err := stub.GetStateByRange(keyPrefix, keyPrefix+string(utf8.MaxRune))
+	if err != nil {
+		Logger.Errorf("error getting audit records with prefix %s: %s", keyPrefix, err.Error())
+		return nil, err
+	}
+	defer it.Close()
+
+	records := make([]AuditRecord, 0)
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			Logger.Errorf("error getting audit records with prefix %s: %s", keyPrefix, err.Error())
+			return nil, err
+		}
+
+		var record AuditRecord
+		if err = json.Unmarshal(kv.GetValue(), &record); err != nil {
+			Logger.Errorf("error deserialising audit record %s as json: %s", kv.GetKey(), err.Error())
+			return nil, err
+		}
+
+		// filter the records by timestamp
+		if (!from.IsZero() && record.Timestamp.Before(from)) || (!to.IsZero() && !record.Timestamp.Before(to)) {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,47 @@
+package invoke
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestAuditTrail(t *testing.T) {
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user1", nil))
+	creator, _ := GetCreatorIDHash(stub)
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if len(args) > 0 {
+			return Error(400, "failed")
+		}
+		return Success(201, nil)
+	}).use(AuditTrail("audit_"))
+
+	// failed invokes are not audited
+	stub.MockInvoke("1", [][]byte{[]byte("create"), []byte("fail")})
+	stub.MockTransactionStart("1")
+	deepEq(t, "failed response", Error(400, "failed"), h(stub, []string{"fail"}))
+
+	stub.MockInvoke("2", [][]byte{[]byte("create")})
+	stub.MockTransactionStart("2")
+	deepEq(t, "successful response", Success(201, nil), h(stub, nil))
+	now, _ := DeterministicNow(stub)
+	argsHash, _ := hashInvokeArgs("create", nil)
+
+	records, err := GetAuditRecords(stub, "audit_", time.Time{}, time.Time{})
+	eq(t, "GetAuditRecords error", nil, err)
+	deepEq(t, "GetAuditRecords", []AuditRecord{{
+		TxID:      "2",
+		Function:  "create",
+		Creator:   creator,
+		Timestamp: now,
+		ArgsHash:  argsHash,
+		Status:    201,
+	}}, records)
+
+	records, _ = GetAuditRecords(stub, "audit_", now.Add(time.Second), time.Time{})
+	eq(t, "len(GetAuditRecords) after timestamp", 0, len(records))
+	records, _ = GetAuditRecords(stub, "audit_", now, now.Add(time.Second))
+	eq(t, "len(GetAuditRecords) including timestamp", 1, len(records))
+}
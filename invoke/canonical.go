@@ -0,0 +1,152 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// PutCanonicalJSON marshals the given object to canonical json and writes it to
+// the ledger, so that equal values are always written as identical bytes.
+// Canonical json has object keys sorted, no insignificant whitespace, no
+// escaping of HTML characters, and numbers in a consistent format: integers
+// without a fraction or exponent are written exactly, and other numbers are
+// written in the shortest form which parses to the same float64.
+func PutCanonicalJSON(stub shim.ChaincodeStubInterface, key string, value interface{}) ([]byte, error) {
+	// serialise the record as canonical json
+	var b []byte
+	var err error
+	if b, err = canonicalJSON(value); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	// write the record to the chain
+	if err = stub.PutState(key, b); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// canonicalJSON marshals the value to canonical json.
+func canonicalJSON(value interface{}) ([]byte, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode the json generically, keeping numbers as they were written
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var generic interface{}
+	if err = d.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = writeCanonicalJSON(&buf, generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonicalJSON writes a value decoded from json to buf as canonical json.
+func writeCanonicalJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		// encode without escaping HTML characters
+		e := json.NewEncoder(buf)
+		e.SetEscapeHTML(false)
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+		// remove the newline added by the encoder
+		buf.Truncate(buf.Len() - 1)
+	case json.Number:
+		n, err := canonicalNumber(v.String())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("unexpected json value of type %T", value)
+	}
+
+	return nil
+}
+
+// canonicalNumber formats a json number consistently. Integers without a
+// fraction or exponent are kept exactly, and other numbers are formatted as the
+// shortest representation of the nearest float64.
+func canonicalNumber(n string) (string, error) {
+	if !strings.ContainsAny(n, ".eE") {
+		i, ok := new(big.Int).SetString(n, 10)
+		if !ok {
+			return "", fmt.Errorf("invalid json number %s", n)
+		}
+		return i.String(), nil
+	}
+
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
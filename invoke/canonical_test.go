@@ -0,0 +1,49 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPutCanonicalJSON(t *testing.T) {
+	type asset struct {
+		Name  string  `json:"name"`
+		Value float64 `json:"value"`
+	}
+
+	var tests = []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"sorted keys", map[string]interface{}{"b": 1, "a": []int{2, 1}}, `{"a":[2,1],"b":1}`},
+		{"struct fields sorted", asset{"<a&b>", 1}, `{"name":"<a&b>","value":1}`},
+		{"raw json normalised", rawJSON(`{ "value": 1.50, "name": "x", "n": -0, "e": 1E2 }`), `{"e":100,"n":0,"name":"x","value":1.5}`},
+		{"large integer kept exactly", rawJSON(`12345678901234567890123`), `12345678901234567890123`},
+		{"nested", rawJSON(`[{"z":null,"y":true},"é"]`), `[{"y":true,"z":null},"é"]`},
+	}
+
+	for _, v := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		b, err := PutCanonicalJSON(stub, "key", v.value)
+		eq(t, v.name+" error", nil, err)
+		eq(t, v.name+" output", v.expected, string(b))
+
+		state, _ := stub.GetState("key")
+		eq(t, v.name+" state", v.expected, string(state))
+	}
+
+	// equivalent values produce identical bytes
+	a, _ := canonicalJSON(map[string]interface{}{"name": "x", "value": 1.5})
+	b, _ := canonicalJSON(asset{"x", 1.5})
+	eq(t, "equivalent values", string(a), string(b))
+}
+
+// rawJSON is a json.Marshaler which returns the json as given.
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
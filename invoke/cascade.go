@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// MaxCascadeDepth is the maximum number of levels of children DeleteCascade
+// deletes below the record it is called with.
+var MaxCascadeDepth = 8
+
+// ErrCascadeTooDeep is returned by DeleteCascade when records are nested more
+// than MaxCascadeDepth levels deep, which usually means the child queries
+// form a cycle.
+var ErrCascadeTooDeep = errors.New("cascading delete is too deep")
+
+// DeleteCascade deletes the record stored under key, and every record returned
+// by the rich query childQueryFn(key), then recursively the children of each
+// of those records, for parent-child models where the dependents of a record
+// must not outlive it. childQueryFn may return an empty query for a record
+// which has no children. Each record is only deleted once, even if several
+// queries return it.
+//
+// All the deletes are part of the transaction, so either all of them are
+// committed or, if any of them fails or the transaction is not committed,
+// none of them are. However, Fabric does not re-run rich queries when it
+// validates the transaction, so a child added by a concurrent transaction
+// after the children were queried is not deleted, and is left without a
+// parent. Chaincode which must not leave orphans has to check the parent
+// exists when adding a child, or clean up orphans later. An error wrapping
+// ErrCascadeTooDeep is returned if the children are nested more than
+// MaxCascadeDepth levels deep, in which case the transaction must not be
+// committed.
+func DeleteCascade(stub shim.ChaincodeStubInterface, key string, childQueryFn func(key string) string) error {
+	return deleteCascade(stub, key, childQueryFn, 0, make(map[string]bool))
+}
+
+// deleteCascade deletes the record stored under key and its children, skipping
+// records which have already been deleted.
+func deleteCascade(stub shim.ChaincodeStubInterface, key string, childQueryFn func(key string) string, depth int, deleted map[string]bool) error {
+	if deleted[key] {
+		return nil
+	}
+	if depth > MaxCascadeDepth {
+		err := fmt.Errorf("%w: %s is more than %d levels deep", ErrCascadeTooDeep, key, MaxCascadeDepth)
+		Logger.Error(err.Error())
+		return err
+	}
+
+	if err := DeleteJSON(stub, key); err != nil {
+		return err
+	}
+	deleted[key] = true
+
+	query := childQueryFn(key)
+	if query == "" {
+		return nil
+	}
+
+	// collect the children before deleting them, so that only one query
+	// iterator is open at a time
+	var children []string
+	err := StreamQueryResult(stub, query, func(childKey string, record []byte) error {
+		children = append(children, childKey)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error querying children of %s: %w", key, err)
+		Logger.Error(err.Error())
+		return err
+	}
+
+	for _, childKey := range children {
+		if err = deleteCascade(stub, childKey, childQueryFn, depth+1, deleted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
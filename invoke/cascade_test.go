@@ -0,0 +1,74 @@
+package invoke
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// parentQueryStub is a mock stub which supports rich queries by returning the
+// records whose parent field is the query string.
+type parentQueryStub struct {
+	*shim.MockStub
+}
+
+func (s parentQueryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	results := &kvIterator{}
+	for it.HasNext() {
+		kv, _ := it.Next()
+		var record struct {
+			Parent string `json:"parent"`
+		}
+		if json.Unmarshal(kv.Value, &record) == nil && record.Parent == query {
+			results.kvs = append(results.kvs, kv)
+		}
+	}
+	return results, nil
+}
+
+func TestDeleteCascade(t *testing.T) {
+	stub := parentQueryStub{shim.NewMockStub("test", new(testCC))}
+	stub.MockTransactionStart("123")
+	childQueryFn := func(key string) string { return key }
+
+	PutJSON(stub, "a", map[string]string{})
+	PutJSON(stub, "a1", map[string]string{"parent": "a"})
+	PutJSON(stub, "a2", map[string]string{"parent": "a"})
+	PutJSON(stub, "a11", map[string]string{"parent": "a1"})
+	PutJSON(stub, "b", map[string]string{})
+	PutJSON(stub, "b1", map[string]string{"parent": "b"})
+
+	err := DeleteCascade(stub, "a", childQueryFn)
+	eq(t, "DeleteCascade error", nil, err)
+	for _, key := range []string{"a", "a1", "a2", "a11"} {
+		value, _ := stub.GetState(key)
+		eq(t, "len(GetState("+key+"))", 0, len(value))
+	}
+	for _, key := range []string{"b", "b1"} {
+		value, _ := stub.GetState(key)
+		notNil(t, "GetState("+key+")", value)
+	}
+
+	// records without a child query are deleted alone
+	err = DeleteCascade(stub, "b", func(key string) string { return "" })
+	eq(t, "DeleteCascade error without child query", nil, err)
+	value, _ := stub.GetState("b1")
+	notNil(t, "GetState(b1)", value)
+
+	// records nested too deeply are rejected
+	defer func(depth int) { MaxCascadeDepth = depth }(MaxCascadeDepth)
+	MaxCascadeDepth = 1
+	PutJSON(stub, "c", map[string]string{})
+	PutJSON(stub, "c1", map[string]string{"parent": "c"})
+	PutJSON(stub, "c11", map[string]string{"parent": "c1"})
+	err = DeleteCascade(stub, "c", childQueryFn)
+	eq(t, "errors.Is(err, ErrCascadeTooDeep)", true, errors.Is(err, ErrCascadeTooDeep))
+}
@@ -0,0 +1,114 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// InvokeChaincodeJSON calls function on the chaincode ccName on channel, which
+// may be empty for the current channel. Strings and byte slices are passed as
+// they are, and any other args are marshalled to json. If the response doesn't
+// have a 2xx status, an error from ResponseError is returned, otherwise the
+// json payload is decoded, keeping numbers as json.Number. An empty payload is
+// decoded to nil.
+func InvokeChaincodeJSON(stub shim.ChaincodeStubInterface, ccName, function string, channel string, args ...interface{}) (interface{}, error) {
+	invokeArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			invokeArgs[i] = []byte(v)
+		case []byte:
+			invokeArgs[i] = v
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				err = fmt.Errorf("error marshalling argument %d for %s: %w", i, ccName, err)
+				Logger.Error(err.Error())
+				return nil, err
+			}
+			invokeArgs[i] = b
+		}
+	}
+
+	payload, err := invokeChaincode(stub, ccName, channel, function, invokeArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) == 0 {
+		return nil, nil
+	}
+
+	value, err := decodeJSONWithNumbers(payload)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling response of %s on %s: %w", function, ccName, err)
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// CallChaincode calls function on the chaincode ccName on channel, which may be
+// empty for the current channel, and unmarshals the json payload of the
+// response into a T. An error is returned if the response doesn't have a 2xx
+// status, from ResponseError, or if the payload is empty or can't be
+// unmarshalled into a T.
+func CallChaincode[T any](stub shim.ChaincodeStubInterface, ccName, channel, function string, args ...string) (T, error) {
+	var value T
+
+	invokeArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		invokeArgs[i] = []byte(arg)
+	}
+
+	payload, err := invokeChaincode(stub, ccName, channel, function, invokeArgs)
+	if err != nil {
+		return value, err
+	}
+
+	if len(payload) == 0 {
+		err := fmt.Errorf("error invoking %s on %s: response has an empty payload", function, ccName)
+		Logger.Error(err.Error())
+		return value, err
+	}
+
+	if err := json.Unmarshal(payload, &value); err != nil {
+		err = fmt.Errorf("error unmarshalling response of %s on %s: %w", function, ccName, err)
+		Logger.Error(err.Error())
+		return value, err
+	}
+
+	return value, nil
+}
+
+// invokeChaincode calls function on the chaincode ccName on channel with the
+// given args, and returns the payload of the response, or an error wrapping the
+// error from ResponseError if it doesn't have a 2xx status.
+func invokeChaincode(stub shim.ChaincodeStubInterface, ccName, channel, function string, args [][]byte) ([]byte, error) {
+	invokeArgs := append([][]byte{[]byte(function)}, args...)
+
+	rsp := stub.InvokeChaincode(ccName, invokeArgs, channel)
+	if err := ResponseError(rsp); err != nil {
+		err = fmt.Errorf("error invoking %s on %s: %w", function, ccName, err)
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return rsp.Payload, nil
+}
@@ -0,0 +1,94 @@
+package invoke
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// routerCC is a chaincode which invokes a router, for testing calls between
+// chaincodes.
+type routerCC struct {
+	router Router
+}
+
+func (c *routerCC) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return Success(200, nil)
+}
+
+func (c *routerCC) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.router.Invoke(stub)
+}
+
+func newCalleeStub() *shim.MockStub {
+	router := NewRouter()
+	router.RegisterHandler("echo", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(args[0]))
+	})
+	router.RegisterHandler("empty", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	router.RegisterHandler("fail", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Error(404, "asset not found")
+	})
+
+	stub := shim.NewMockStub("callee", &routerCC{router})
+	stub.MockTransactionStart("123")
+	return stub
+}
+
+func TestInvokeChaincodeJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.MockPeerChaincode("callee/channel", newCalleeStub())
+
+	value, err := InvokeChaincodeJSON(stub, "callee", "echo", "channel", map[string]int{"amount": 10})
+	eq(t, "InvokeChaincodeJSON error", nil, err)
+	deepEq(t, "InvokeChaincodeJSON value", map[string]interface{}{"amount": json.Number("10")}, value)
+
+	value, err = InvokeChaincodeJSON(stub, "callee", "echo", "channel", `"raw"`)
+	eq(t, "InvokeChaincodeJSON error with string arg", nil, err)
+	deepEq(t, "InvokeChaincodeJSON value with string arg", "raw", value)
+
+	value, err = InvokeChaincodeJSON(stub, "callee", "empty", "channel")
+	eq(t, "InvokeChaincodeJSON error with empty payload", nil, err)
+	eq(t, "InvokeChaincodeJSON value with empty payload", nil, value)
+
+	_, err = InvokeChaincodeJSON(stub, "callee", "fail", "channel")
+	notNil(t, "InvokeChaincodeJSON error with error response", err)
+	eq(t, "InvokeChaincodeJSON error message", "error invoking fail on callee: status 404: asset not found", err.Error())
+	deepEq(t, "ErrorFrom(err)", Error(404, "error invoking fail on callee: status 404: asset not found"), ErrorFrom(err))
+
+	_, err = InvokeChaincodeJSON(stub, "callee", "echo", "channel", "not json")
+	notNil(t, "InvokeChaincodeJSON error with invalid json response", err)
+
+	_, err = InvokeChaincodeJSON(stub, "callee", "echo", "channel", func() {})
+	notNil(t, "InvokeChaincodeJSON error with invalid argument", err)
+}
+
+func TestCallChaincode(t *testing.T) {
+	type asset struct {
+		Amount int `json:"amount"`
+	}
+
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.MockPeerChaincode("callee/channel", newCalleeStub())
+
+	value, err := CallChaincode[asset](stub, "callee", "channel", "echo", `{"amount":10}`)
+	eq(t, "CallChaincode error", nil, err)
+	eq(t, "CallChaincode value", asset{Amount: 10}, value)
+
+	_, err = CallChaincode[asset](stub, "callee", "channel", "empty")
+	notNil(t, "CallChaincode error with empty payload", err)
+	eq(t, "CallChaincode error message with empty payload", "error invoking empty on callee: response has an empty payload", err.Error())
+
+	_, err = CallChaincode[asset](stub, "callee", "channel", "fail")
+	notNil(t, "CallChaincode error with error response", err)
+	deepEq(t, "ErrorFrom(err)", Error(404, "error invoking fail on callee: status 404: asset not found"), ErrorFrom(err))
+
+	_, err = CallChaincode[asset](stub, "callee", "channel", "echo", `"not an asset"`)
+	notNil(t, "CallChaincode error with mismatched payload", err)
+}
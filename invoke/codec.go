@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Codec serialises values written to and read from the ledger.
+type Codec interface {
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(b []byte, valuePtr interface{}) error
+}
+
+// JSONCodec is the Codec used by PutJSON and GetJSON, which uses encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(b []byte, valuePtr interface{}) error {
+	return json.Unmarshal(b, valuePtr)
+}
+
+// PutWithCodec marshals the given object with the codec and writes it to the
+// ledger. The serialised value is returned.
+func PutWithCodec(stub shim.ChaincodeStubInterface, codec Codec, key string, value interface{}) ([]byte, error) {
+	// serialise the record
+	var b []byte
+	var err error
+	if b, err = codec.Marshal(value); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	// write the record to the chain
+	if err = stub.PutState(key, b); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// GetWithCodec retrieves a value from the ledger and attempts to unmarshal it
+// with the codec. If the key does not exist, an error wrapping ErrKeyNotFound
+// is returned.
+func GetWithCodec(stub shim.ChaincodeStubInterface, codec Codec, key string, valuePtr interface{}) error {
+	var b []byte
+	var err error
+	if b, err = stub.GetState(key); err != nil {
+		Logger.Errorf("error getting state of %s from ledger: %s", key, err.Error())
+		return err
+	}
+
+	if len(b) == 0 {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		Logger.Error(err.Error())
+		return err
+	}
+
+	if err = codec.Unmarshal(b, valuePtr); err != nil {
+		Logger.Errorf("error deserialising value of %s: %s", key, err.Error())
+		return err
+	}
+
+	return nil
+}
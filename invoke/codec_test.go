@@ -0,0 +1,56 @@
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// stringCodec is a Codec which serialises *string values as their raw bytes.
+type stringCodec struct{}
+
+func (stringCodec) Marshal(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", value)
+	}
+	return []byte(s), nil
+}
+
+func (stringCodec) Unmarshal(b []byte, valuePtr interface{}) error {
+	s, ok := valuePtr.(*string)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", valuePtr)
+	}
+	*s = string(b)
+	return nil
+}
+
+func TestPutWithCodec(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	b, err := PutWithCodec(stub, stringCodec{}, "key", "value")
+	eq(t, "PutWithCodec(stub, stringCodec{}, \"key\", \"value\") error", nil, err)
+	eq(t, "PutWithCodec(stub, stringCodec{}, \"key\", \"value\")", "value", string(b))
+	state, _ := stub.GetState("key")
+	eq(t, "stub.GetState(\"key\")", "value", string(state))
+
+	_, err = PutWithCodec(stub, stringCodec{}, "key", 1)
+	eq(t, "PutWithCodec(stub, stringCodec{}, \"key\", 1)", "cannot marshal int", err.Error())
+}
+
+func TestGetWithCodec(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("key", []byte("value"))
+
+	var value string
+	eq(t, "GetWithCodec(stub, stringCodec{}, \"key\", &value)", nil, GetWithCodec(stub, stringCodec{}, "key", &value))
+	eq(t, "value", "value", value)
+
+	err := GetWithCodec(stub, stringCodec{}, "missing", &value)
+	eq(t, "errors.Is(GetWithCodec(stub, stringCodec{}, \"missing\", &value), ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+}
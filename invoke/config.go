@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// LoadConfig reads a singleton configuration record, stored as json under key.
+// If the record does not exist yet, the zero value of T is returned, so T
+// should be defined so that its zero value is a sensible default.
+func LoadConfig[T any](stub shim.ChaincodeStubInterface, key string) (T, error) {
+	config, _, err := GetJSONT[T](stub, key)
+	return config, err
+}
+
+// SaveConfig writes a singleton configuration record to the ledger as json
+// under key.
+func SaveConfig[T any](stub shim.ChaincodeStubInterface, key string, config T) error {
+	_, err := PutJSON(stub, key, config)
+	return err
+}
+
+// InjectConfig creates a middleware that loads the configuration record stored
+// under key with LoadConfig, and stores it in the context under contextKey as
+// a T, so handlers don't each read it from the ledger. The record is only
+// loaded once per transaction, so InjectConfig can be used both globally and
+// on handlers without reading it again. Reading it once is safe, as Fabric
+// does not return writes made earlier in the same transaction anyway.
+func InjectConfig[T any](router Router, key string, contextKey string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		ctx := router.GetContext(stub)
+		if _, ok := ctx[contextKey].(T); !ok {
+			config, err := LoadConfig[T](stub, key)
+			if err != nil {
+				router.log().Error(err)
+				return Error(http.StatusInternalServerError, fmt.Sprintf("error loading config: %s", err.Error()))
+			}
+			ctx[contextKey] = config
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
@@ -0,0 +1,55 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type testConfig struct {
+	MaxTransfer int      `json:"maxTransfer"`
+	Admins      []string `json:"admins"`
+}
+
+func TestLoadConfig(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	config, err := LoadConfig[testConfig](stub, "config")
+	eq(t, "LoadConfig error before saving", nil, err)
+	deepEq(t, "LoadConfig before saving", testConfig{}, config)
+
+	expected := testConfig{MaxTransfer: 10, Admins: []string{"a"}}
+	eq(t, "SaveConfig error", nil, SaveConfig(stub, "config", expected))
+	config, err = LoadConfig[testConfig](stub, "config")
+	eq(t, "LoadConfig error", nil, err)
+	deepEq(t, "LoadConfig", expected, config)
+
+	stub.PutState("invalid", []byte(`{`))
+	_, err = LoadConfig[testConfig](stub, "invalid")
+	notNil(t, "LoadConfig error with invalid json", err)
+}
+
+func TestInjectConfig(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	SaveConfig(stub, "config", testConfig{MaxTransfer: 10})
+	stub.MockTransactionEnd("123")
+	recorder := NewRecordingStub(stub)
+
+	router := NewRouter()
+	router.Use(InjectConfig[testConfig](router, "config", "config"))
+	var config testConfig
+	router.RegisterHandler("transfer", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		config = MustContextValue[testConfig](router, stub, "config")
+		return Success(200, nil)
+	}, InjectConfig[testConfig](router, "config", "config"))
+
+	stub.MockInvoke("1", [][]byte{[]byte("transfer")})
+	stub.MockTransactionStart("1")
+	deepEq(t, "transfer response", Success(200, nil), router.Invoke(recorder))
+	deepEq(t, "config in context", testConfig{MaxTransfer: 10}, config)
+	// the config is only read once, even though the middleware is used twice
+	eq(t, "reads of config", 1, len(recorder.Reads()))
+}
@@ -0,0 +1,43 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ContextValue gets the value stored under the given key in the transaction's
+// context as type T. ok is false if there is no value for the key, or if the
+// value is not of type T.
+func ContextValue[T any](r Router, stub shim.ChaincodeStubInterface, key string) (value T, ok bool) {
+	value, ok = r.GetContext(stub)[key].(T)
+	return value, ok
+}
+
+// MustContextValue gets the value stored under the given key in the
+// transaction's context as type T. If there is no value for the key, or the
+// value is not of type T, the error is logged and MustContextValue panics. Use
+// the Recover middleware to convert the panic into an error response.
+func MustContextValue[T any](r Router, stub shim.ChaincodeStubInterface, key string) T {
+	value, ok := ContextValue[T](r, stub, key)
+	if !ok {
+		err := fmt.Sprintf("context value %s was missing or not of type %T", key, value)
+		r.log().Error(err)
+		panic(err)
+	}
+
+	return value
+}
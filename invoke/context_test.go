@@ -0,0 +1,45 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestContextValue(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	// create the transaction context, this is normally done in router.Invoke()
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	router.GetContext(stub)["int"] = 1
+
+	i, ok := ContextValue[int](router, stub, "int")
+	eq(t, "ContextValue[int](router, stub, \"int\")", 1, i)
+	eq(t, "ContextValue[int](router, stub, \"int\") ok", true, ok)
+
+	s, ok := ContextValue[string](router, stub, "int")
+	eq(t, "ContextValue[string](router, stub, \"int\")", "", s)
+	eq(t, "ContextValue[string](router, stub, \"int\") ok", false, ok)
+
+	_, ok = ContextValue[int](router, stub, "missing")
+	eq(t, "ContextValue[int](router, stub, \"missing\") ok", false, ok)
+}
+
+func TestMustContextValue(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	// create the transaction context, this is normally done in router.Invoke()
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	router.GetContext(stub)["int"] = 1
+
+	eq(t, "MustContextValue[int](router, stub, \"int\")", 1, MustContextValue[int](router, stub, "int"))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustContextValue[string](router, stub, \"int\") did not panic")
+		}
+	}()
+	MustContextValue[string](router, stub, "int")
+}
@@ -0,0 +1,114 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// decimalPattern matches fixed-point decimal numbers, such as "-12.50".
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// DecimalOptions restricts the values accepted by DecimalParser. The zero value
+// accepts any decimal which is not negative.
+type DecimalOptions struct {
+	// AllowNegative allows negative values.
+	AllowNegative bool
+	// Min and Max are the inclusive bounds of the value as decimal strings, and
+	// are not checked if empty.
+	Min, Max string
+}
+
+// DecimalParser creates a middleware that parses the specified argument as a
+// fixed-point decimal number, such as "12.50", and stores it in the context as
+// a *big.Rat, so that amounts are represented exactly. Values which are
+// negative, unless opts.AllowNegative is set, or outside the bounds in opts are
+// rejected with a 400 error. DecimalParser panics if the bounds in opts are not
+// valid decimals.
+func DecimalParser(router Router, argIndex int, contextKey string, opts DecimalOptions) Middleware {
+	minBound := parseDecimalBound(opts.Min)
+	maxBound := parseDecimalBound(opts.Max)
+
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error parsing decimal: %s", err))
+		}
+
+		// parse decimal
+		value, ok := parseDecimal(args[argIndex])
+		if !ok {
+			err := fmt.Sprintf("error parsing decimal: %q is not a decimal number", args[argIndex])
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// check the value is allowed
+		var err string
+		switch {
+		case !opts.AllowNegative && value.Sign() < 0:
+			err = fmt.Sprintf("decimal %s must not be negative", args[argIndex])
+		case minBound != nil && value.Cmp(minBound) < 0:
+			err = fmt.Sprintf("decimal %s must be at least %s", args[argIndex], opts.Min)
+		case maxBound != nil && value.Cmp(maxBound) > 0:
+			err = fmt.Sprintf("decimal %s must be at most %s", args[argIndex], opts.Max)
+		}
+		if err != "" {
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// write decimal to context
+		router.GetContext(stub)[contextKey] = value
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// GetDecimal gets the decimal stored in the context under the given key by
+// DecimalParser. ok is false if there is no decimal for the key.
+func GetDecimal(r Router, stub shim.ChaincodeStubInterface, key string) (value *big.Rat, ok bool) {
+	return ContextValue[*big.Rat](r, stub, key)
+}
+
+// parseDecimal parses a fixed-point decimal string exactly.
+func parseDecimal(s string) (*big.Rat, bool) {
+	if !decimalPattern.MatchString(s) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// parseDecimalBound parses an optional bound for DecimalParser, returning nil
+// if it is empty.
+func parseDecimalBound(s string) *big.Rat {
+	if s == "" {
+		return nil
+	}
+
+	bound, ok := parseDecimal(s)
+	if !ok {
+		panic(fmt.Sprintf("invalid decimal bound %q", s))
+	}
+	return bound
+}
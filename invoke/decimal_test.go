@@ -0,0 +1,60 @@
+package invoke
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestDecimalParser(t *testing.T) {
+	var tests = []struct {
+		name     string
+		opts     DecimalOptions
+		args     []string
+		rsp      pb.Response
+		expected *big.Rat
+	}{
+		{"decimal", DecimalOptions{}, []string{"12.50"}, Success(200, nil), big.NewRat(25, 2)},
+		{"integer", DecimalOptions{}, []string{"3"}, Success(200, nil), big.NewRat(3, 1)},
+		{"missing argument", DecimalOptions{}, nil, Error(500, "error parsing decimal: argIndex 0 was greater than length of args"), nil},
+		{"fraction", DecimalOptions{}, []string{"1/3"}, Error(400, "error parsing decimal: \"1/3\" is not a decimal number"), nil},
+		{"exponent", DecimalOptions{}, []string{"1e3"}, Error(400, "error parsing decimal: \"1e3\" is not a decimal number"), nil},
+		{"negative", DecimalOptions{}, []string{"-1.5"}, Error(400, "decimal -1.5 must not be negative"), nil},
+		{"negative allowed", DecimalOptions{AllowNegative: true}, []string{"-1.5"}, Success(200, nil), big.NewRat(-3, 2)},
+		{"below min", DecimalOptions{Min: "0.01"}, []string{"0.001"}, Error(400, "decimal 0.001 must be at least 0.01"), nil},
+		{"above max", DecimalOptions{Max: "100"}, []string{"100.01"}, Error(400, "decimal 100.01 must be at most 100"), nil},
+		{"at max", DecimalOptions{Max: "100"}, []string{"100.00"}, Success(200, nil), big.NewRat(100, 1)},
+	}
+
+	for _, v := range tests {
+		router := NewRouter()
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		var actual *big.Rat
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual, _ = GetDecimal(router, stub, "amount")
+			return Success(200, nil)
+		})
+
+		deepEq(t, v.name+" response", v.rsp, h.use(DecimalParser(router, 0, "amount", v.opts))(stub, v.args))
+		if v.expected == nil {
+			eq(t, v.name+" value", (*big.Rat)(nil), actual)
+		} else {
+			eq(t, v.name+" value", v.expected.String(), actual.String())
+		}
+	}
+}
+
+func TestDecimalParserInvalidBound(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("DecimalParser with invalid bound did not panic")
+		}
+	}()
+	DecimalParser(NewRouter(), 0, "amount", DecimalOptions{Min: "abc"})
+}
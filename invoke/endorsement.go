@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+)
+
+// EndorsementMode selects how many of the orgs in a key-level endorsement
+// policy must endorse changes to the key.
+type EndorsementMode int
+
+const (
+	// EndorseAll requires a member of every org to endorse changes.
+	EndorseAll EndorsementMode = iota
+	// EndorseAny requires a member of any one of the orgs to endorse changes.
+	EndorseAny
+)
+
+// SetStateEndorsementPolicy sets a key-level endorsement policy on the key,
+// which overrides the chaincode endorsement policy for changes to the key.
+// Depending on mode, a member of all, or any one, of the given MSP IDs must
+// endorse changes.
+func SetStateEndorsementPolicy(stub shim.ChaincodeStubInterface, key string, mode EndorsementMode, mspIDs ...string) error {
+	if len(mspIDs) == 0 {
+		err := errors.New("an endorsement policy requires at least one org")
+		Logger.Error(err.Error())
+		return err
+	}
+
+	// build the policy
+	var policy []byte
+	var err error
+	switch mode {
+	case EndorseAll:
+		ep, _ := statebased.NewStateEP(nil)
+		if err = ep.AddOrgs(statebased.RoleTypeMember, mspIDs...); err != nil {
+			break
+		}
+		policy, err = ep.Policy()
+	case EndorseAny:
+		// copy the MSP IDs, as they are sorted in place
+		policy, err = proto.Marshal(cauthdsl.SignedByAnyMember(append([]string(nil), mspIDs...)))
+	default:
+		err = errors.New("unknown endorsement mode")
+	}
+	if err != nil {
+		Logger.Errorf("error building endorsement policy for %s: %s", key, err.Error())
+		return err
+	}
+
+	// set the policy on the key
+	if err = stub.SetStateValidationParameter(key, policy); err != nil {
+		Logger.Errorf("error setting endorsement policy for %s: %s", key, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetStateEndorsementPolicy gets the sorted MSP IDs of the orgs in the
+// key-level endorsement policy of the key. If the key has no key-level policy,
+// an empty list is returned.
+func GetStateEndorsementPolicy(stub shim.ChaincodeStubInterface, key string) ([]string, error) {
+	policy, err := stub.GetStateValidationParameter(key)
+	if err != nil {
+		Logger.Errorf("error getting endorsement policy for %s: %s", key, err.Error())
+		return nil, err
+	}
+
+	ep, err := statebased.NewStateEP(policy)
+	if err != nil {
+		Logger.Errorf("error parsing endorsement policy for %s: %s", key, err.Error())
+		return nil, err
+	}
+
+	mspIDs := ep.ListOrgs()
+	sort.Strings(mspIDs)
+	return mspIDs, nil
+}
@@ -0,0 +1,43 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	cb "github.com/hyperledger/fabric/protos/common"
+)
+
+func TestStateEndorsementPolicy(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	mspIDs, err := GetStateEndorsementPolicy(stub, "key")
+	eq(t, "GetStateEndorsementPolicy(stub, \"key\") error without policy", nil, err)
+	eq(t, "len(GetStateEndorsementPolicy(stub, \"key\")) without policy", 0, len(mspIDs))
+
+	var tests = []struct {
+		name string
+		mode EndorsementMode
+		n    int32
+	}{
+		{"all", EndorseAll, 2},
+		{"any", EndorseAny, 1},
+	}
+
+	for _, v := range tests {
+		eq(t, v.name+" SetStateEndorsementPolicy error", nil, SetStateEndorsementPolicy(stub, "key", v.mode, "Org2MSP", "Org1MSP"))
+
+		mspIDs, err := GetStateEndorsementPolicy(stub, "key")
+		eq(t, v.name+" GetStateEndorsementPolicy error", nil, err)
+		deepEq(t, v.name+" GetStateEndorsementPolicy", []string{"Org1MSP", "Org2MSP"}, mspIDs)
+
+		// check the number of signatures required by the policy
+		b, _ := stub.GetStateValidationParameter("key")
+		policy := &cb.SignaturePolicyEnvelope{}
+		proto.Unmarshal(b, policy)
+		eq(t, v.name+" signatures required", v.n, policy.GetRule().GetNOutOf().GetN())
+	}
+
+	notNil(t, "SetStateEndorsementPolicy error without orgs", SetStateEndorsementPolicy(stub, "key", EndorseAll))
+}
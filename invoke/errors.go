@@ -0,0 +1,109 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// InvokeError is an error carrying the status code of the response that should
+// be returned for it.
+type InvokeError struct {
+	Status  int32
+	Message string
+	// Err is the underlying cause of the error, if any
+	Err error
+}
+
+// Error returns the message of the error.
+func (e *InvokeError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *InvokeError) Unwrap() error {
+	return e.Err
+}
+
+// NewInvokeError returns an InvokeError with the given status and message,
+// caused by err, which may be nil.
+func NewInvokeError(status int32, message string, err error) *InvokeError {
+	return &InvokeError{
+		Status:  status,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// BadRequest returns an InvokeError with a 400 status.
+func BadRequest(message string) *InvokeError {
+	return NewInvokeError(http.StatusBadRequest, message, nil)
+}
+
+// Forbidden returns an InvokeError with a 403 status.
+func Forbidden(message string) *InvokeError {
+	return NewInvokeError(http.StatusForbidden, message, nil)
+}
+
+// NotFound returns an InvokeError with a 404 status.
+func NotFound(message string) *InvokeError {
+	return NewInvokeError(http.StatusNotFound, message, nil)
+}
+
+// Conflict returns an InvokeError with a 409 status.
+func Conflict(message string) *InvokeError {
+	return NewInvokeError(http.StatusConflict, message, nil)
+}
+
+// Internal returns an InvokeError with a 500 status.
+func Internal(message string) *InvokeError {
+	return NewInvokeError(http.StatusInternalServerError, message, nil)
+}
+
+// ErrorFrom creates an error response from the given error. If the error is
+// or wraps an InvokeError, its status is used. Errors wrapping ErrKeyNotFound
+// have a 404 status, and any other error has a 500 status. A nil error is a
+// bug in the caller, and also has a 500 status, so it never passes as success.
+func ErrorFrom(err error) pb.Response {
+	if err == nil {
+		Logger.Error("ErrorFrom called with a nil error")
+		return Error(http.StatusInternalServerError, "internal server error")
+	}
+
+	var invokeErr *InvokeError
+	if errors.As(err, &invokeErr) {
+		return Error(invokeErr.Status, err.Error())
+	}
+
+	if errors.Is(err, ErrKeyNotFound) {
+		return Error(http.StatusNotFound, err.Error())
+	}
+
+	return Error(http.StatusInternalServerError, err.Error())
+}
+
+// ResponseError returns nil if the response has a 2xx status, and otherwise an
+// InvokeError with the status of the response and a message including it, for
+// checking the response of another chaincode called with InvokeChaincode.
+func ResponseError(rsp pb.Response) error {
+	if rsp.Status >= 200 && rsp.Status < 300 {
+		return nil
+	}
+
+	return NewInvokeError(rsp.Status, fmt.Sprintf("status %d: %s", rsp.Status, rsp.Message), nil)
+}
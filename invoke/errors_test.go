@@ -0,0 +1,52 @@
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var errorFromTests = []struct {
+	err         error
+	expectedRsp pb.Response
+}{
+	{BadRequest("bad request"), Error(400, "bad request")},
+	{Forbidden("forbidden"), Error(403, "forbidden")},
+	{NotFound("not found"), Error(404, "not found")},
+	{Conflict("conflict"), Error(409, "conflict")},
+	{Internal("internal"), Error(500, "internal")},
+	{NewInvokeError(409, "conflict", errors.New("cause")), Error(409, "conflict")},
+	{fmt.Errorf("wrapped: %w", BadRequest("bad request")), Error(400, "wrapped: bad request")},
+	{fmt.Errorf("%w: key", ErrKeyNotFound), Error(404, "key not found: key")},
+	{errors.New("unknown"), Error(500, "unknown")},
+}
+
+func TestErrorFrom(t *testing.T) {
+	for _, v := range errorFromTests {
+		deepEq(t, fmt.Sprintf("ErrorFrom(%#v)", v.err), v.expectedRsp, ErrorFrom(v.err))
+	}
+}
+
+func TestErrorFromNil(t *testing.T) {
+	deepEq(t, "ErrorFrom(nil)", Error(500, "internal server error"), ErrorFrom(nil))
+}
+
+func TestInvokeErrorUnwrap(t *testing.T) {
+	cause := errors.New("cause")
+	err := NewInvokeError(500, "error", cause)
+	eq(t, "errors.Is(err, cause)", true, errors.Is(err, cause))
+}
+
+func TestResponseError(t *testing.T) {
+	eq(t, "ResponseError(200)", nil, ResponseError(Success(200, nil)))
+	eq(t, "ResponseError(201)", nil, ResponseError(Success(201, nil)))
+
+	err := ResponseError(Error(404, "not found"))
+	notNil(t, "ResponseError(404)", err)
+	eq(t, "ResponseError(404).Error()", "status 404: not found", err.Error())
+	deepEq(t, "ErrorFrom(ResponseError(404))", Error(404, "status 404: not found"), ErrorFrom(err))
+
+	notNil(t, "ResponseError(302)", ResponseError(Success(302, nil)))
+}
@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// VersionKey is the context key under which handlers registered with a
+// versioned route group have their version stored, as a string.
+const VersionKey = ReservedKeyPrefix + "version"
+
+// RouteGroup registers handlers on a router under a shared function name
+// prefix, wrapping each of them in a shared set of middleware.
+type RouteGroup struct {
+	router          *Router
+	prefix          string
+	middlewareChain []Middleware
+}
+
+// Group returns a new RouteGroup which registers handlers on the router with
+// the given prefix, and attaches the given middleware to each of them.
+func (r *Router) Group(prefix string, mws ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:          r,
+		prefix:          prefix,
+		middlewareChain: append(make([]Middleware, 0, len(mws)), mws...),
+	}
+}
+
+// Version returns a new RouteGroup which registers handlers on the router with
+// the prefix v + "/", such as "v1/transfer", and stores v in the context under
+// VersionKey before running the handler's middleware.
+func (r *Router) Version(v string) *RouteGroup {
+	return r.Group(v+"/", func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// store the version in the context
+		r.GetContext(stub)[VersionKey] = v
+
+		// call next handler
+		return next(stub, args)
+	})
+}
+
+// DefaultVersion sets the version used for invokes of a function which is not
+// registered under its bare name, so that invoking "transfer" calls the handler
+// registered as "v1/transfer" by router.Version("v1"). Setting it to an empty
+// string disables this.
+func (r *Router) DefaultVersion(v string) {
+	r.defaultVersion = v
+}
+
+// Use adds the given middleware to the list of middleware used on handlers
+// registered with the group after this call.
+func (g *RouteGroup) Use(mws ...Middleware) {
+	g.middlewareChain = append(g.middlewareChain, mws...)
+}
+
+// RegisterHandler adds a new handler to the router under the group's prefix.
+// The group's middleware is run before any specific middleware provided.
+func (g *RouteGroup) RegisterHandler(functionName string, h Handler, mws ...Middleware) Handler {
+	// copy the group middleware so the group's chain is never modified
+	chain := make([]Middleware, 0, len(g.middlewareChain)+len(mws))
+	chain = append(chain, g.middlewareChain...)
+	chain = append(chain, mws...)
+
+	return g.router.RegisterHandler(g.prefix+functionName, h, chain...)
+}
+
+// Mount registers each of the child router's handlers on the router under the
+// prefix, so that separate modules of a chaincode can each build their own
+// router. The child's global middleware runs after the router's global
+// middleware, and before the handler's own middleware. The child's
+// middleware shares the router's transaction context, so it can be read by
+// either router. Handlers and middleware added to the child after it is mounted
+// are not mounted. If any of the prefixed function names is already registered,
+// an error is returned and no handlers are mounted.
+func (r *Router) Mount(prefix string, child Router) error {
+	// check for collisions before registering anything
+	routes := child.Routes()
+	for _, functionName := range routes {
+		if r.HasHandler(prefix + functionName) {
+			err := fmt.Errorf("cannot mount function %s, as it is already registered", prefix+functionName)
+			r.log().Error(err.Error())
+			return err
+		}
+	}
+
+	for _, functionName := range routes {
+		h := child.invokeMap[functionName].use(child.middlewareChain...)
+		r.invokeMap[prefix+functionName] = func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			// share the transaction context with the child
+			txID := stub.GetTxID()
+			child.setContext(txID, r.GetContext(stub))
+			defer child.deleteContext(txID)
+
+			return h(stub, args)
+		}
+		if meta, ok := child.meta[functionName]; ok {
+			r.meta[prefix+functionName] = meta
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package invoke
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestGroupRegisterHandler(t *testing.T) {
+	router := NewRouter()
+	key := "test"
+	router.Use(mwIntAppender(router, key, 1))
+	group := router.Group("asset_", mwIntAppender(router, key, 2))
+	group.RegisterHandler(
+		"create",
+		hIntAppender(router, key, 4),
+		mwIntAppender(router, key, 3),
+	)
+
+	_, ok := router.invokeMap["asset_create"]
+	eq(t, "router.invokeMap[\"asset_create\"] exists", true, ok)
+
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	h := router.invokeMap["asset_create"].use(router.middlewareChain...)
+	h(stub, nil)
+
+	deepEq(t, "router.GetContext(stub)[key]", []int{1, 2, 3, 4}, router.GetContext(stub)[key])
+}
+
+func TestGroupUse(t *testing.T) {
+	router := NewRouter()
+	group := router.Group("asset_")
+	group.Use(mwIntAppender(router, "test", 1))
+
+	eq(t, "len(group.middlewareChain)", 1, len(group.middlewareChain))
+	eq(t, "len(router.middlewareChain)", 0, len(router.middlewareChain))
+}
+
+func TestVersion(t *testing.T) {
+	router := NewRouter()
+	versionHandler := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(MustContextValue[string](router, stub, VersionKey)))
+	}
+	router.Version("v1").RegisterHandler("transfer", versionHandler)
+	router.Version("v2").RegisterHandler("transfer", versionHandler)
+
+	deepEq(t, "v1/transfer response", Success(200, []byte("v1")), invokeRouter(&router, "1", "v1/transfer"))
+	deepEq(t, "v2/transfer response", Success(200, []byte("v2")), invokeRouter(&router, "2", "v2/transfer"))
+	eq(t, "transfer status without default version", int32(400), invokeRouter(&router, "3", "transfer").Status)
+
+	router.DefaultVersion("v2")
+	deepEq(t, "transfer response with default version", Success(200, []byte("v2")), invokeRouter(&router, "4", "transfer"))
+}
+
+func TestMount(t *testing.T) {
+	key := "test"
+	child := NewRouter()
+	child.Use(mwIntAppender(child, key, 2))
+	child.RegisterHandler("create", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(fmt.Sprint(child.GetContext(stub)[key])))
+	}, mwIntAppender(child, key, 3))
+
+	parent := NewRouter()
+	parent.Use(mwIntAppender(parent, key, 1))
+	parent.RegisterHandler("asset_delete", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	eq(t, "parent.Mount(\"asset_\", child) error", nil, parent.Mount("asset_", child))
+	deepEq(t, "parent.Routes()", []string{"asset_create", "asset_delete"}, parent.Routes())
+	// the parent, child and handler middleware all share the context
+	deepEq(t, "asset_create response", Success(200, []byte("[1 2 3]")), invokeRouter(&parent, "123", "asset_create"))
+	eq(t, "len(child.context)", 0, len(child.context))
+
+	collision := NewRouter()
+	collision.RegisterHandler("a", hIntAppender(collision, key, 1))
+	collision.RegisterHandler("delete", hIntAppender(collision, key, 1))
+	err := parent.Mount("asset_", collision)
+	eq(t, "parent.Mount(\"asset_\", collision) error", "cannot mount function asset_delete, as it is already registered", err.Error())
+	eq(t, "parent.HasHandler(\"asset_a\")", false, parent.HasHandler("asset_a"))
+}
+
+func TestMountConcurrent(t *testing.T) {
+	child := NewRouter()
+	child.RegisterHandler("create", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		child.GetContext(stub)["test"] = args[0]
+		return Success(200, []byte(MustContextValue[string](child, stub, "test")))
+	})
+	parent := NewRouter()
+	parent.Mount("asset_", child)
+
+	// run with -race to check access to the child's contexts is synchronized
+	var wg sync.WaitGroup
+	rsps := make([]pb.Response, 20)
+	for i := range rsps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsps[i] = invokeRouter(&parent, fmt.Sprint(i), "asset_create", fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, rsp := range rsps {
+		deepEq(t, fmt.Sprintf("response %d", i), Success(200, []byte(fmt.Sprint(i))), rsp)
+	}
+	eq(t, "len(child.context)", 0, len(child.context))
+}
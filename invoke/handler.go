@@ -14,6 +14,12 @@ limitations under the License.
 package invoke
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -21,6 +27,10 @@ import (
 // Handler is a function that handles an invoke call.
 type Handler func(shim.ChaincodeStubInterface, []string) pb.Response
 
+// CtxHandler is a function that handles an invoke call, and is passed a
+// context.Context derived from the transaction.
+type CtxHandler func(context.Context, shim.ChaincodeStubInterface, []string) pb.Response
+
 // Middleware is a function that wraps a handler to perform a specific task,
 // and then calls the handler and returns its result
 type Middleware func(shim.ChaincodeStubInterface, []string, Handler) pb.Response
@@ -43,3 +53,169 @@ func (h Handler) use(m ...Middleware) Handler {
 	// return the new handler
 	return h
 }
+
+// Chain combines the provided middleware into a single middleware, which runs
+// them in the order provided, so that a reusable stack of middleware can be
+// passed to Use or RegisterHandler as one unit.
+func Chain(mws ...Middleware) Middleware {
+	// copy the middleware so later changes to the slice have no effect
+	mws = append([]Middleware(nil), mws...)
+
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		return next.use(mws...)(stub, args)
+	}
+}
+
+// TypedHandler returns a handler which unmarshals the json in the specified
+// argument position into a *T, and calls fn with the result. Errors are handled
+// in the same way as JSONParser.
+func TypedHandler[T any](fn func(shim.ChaincodeStubInterface, *T) pb.Response, argIndex int) Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		value := new(T)
+		if err := unmarshalJSONArg(Logger, args, argIndex, value); err != nil {
+			return ErrorFrom(err)
+		}
+
+		return fn(stub, value)
+	}
+}
+
+// BatchResult is the result of a single item processed by a batch handler. The
+// payload is included as json if it is valid json, or as a json string
+// otherwise.
+type BatchResult struct {
+	Status  int32           `json:"status"`
+	Message string          `json:"message,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// BatchHandler returns a handler which unmarshals the first argument as a json
+// array, and calls itemFn with each item in turn. If every item succeeds, the
+// response payload is a json array of BatchResult. Processing stops at the
+// first item with an error status, and its error is returned with the index of
+// the item, so the transaction fails as a whole.
+func BatchHandler(itemFn func(shim.ChaincodeStubInterface, json.RawMessage) pb.Response) Handler {
+	return batchHandler(itemFn, false)
+}
+
+// BatchHandlerContinueOnError returns a handler like BatchHandler, except that
+// every item is processed even if some fail. The status of each item is
+// included in the results, and the response status is 207 if any item failed.
+// Ledger writes and events made by an item are held back until it returns, and
+// are discarded if it fails, so a failed item never leaves partial writes.
+func BatchHandlerContinueOnError(itemFn func(shim.ChaincodeStubInterface, json.RawMessage) pb.Response) Handler {
+	return batchHandler(itemFn, true)
+}
+
+// batchHandler returns a handler which calls itemFn with each item of the json
+// array in the first argument.
+func batchHandler(itemFn func(shim.ChaincodeStubInterface, json.RawMessage) pb.Response, continueOnError bool) Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		var items []json.RawMessage
+		if err := unmarshalJSONArg(Logger, args, 0, &items); err != nil {
+			return ErrorFrom(err)
+		}
+
+		status := int32(http.StatusOK)
+		results := make([]BatchResult, 0, len(items))
+		for i, item := range items {
+			// hold back the item's writes, so they can be discarded if it fails
+			buffered := &bufferedStub{ChaincodeStubInterface: stub}
+			rsp := itemFn(buffered, item)
+			if rsp.Status >= shim.ERRORTHRESHOLD {
+				if !continueOnError {
+					err := fmt.Sprintf("error processing batch item %d: %s", i, rsp.Message)
+					Logger.Error(err)
+					return Error(rsp.Status, err)
+				}
+				status = http.StatusMultiStatus
+			} else if err := buffered.flush(); err != nil {
+				err := fmt.Sprintf("error writing batch item %d: %s", i, err.Error())
+				Logger.Error(err)
+				return Error(http.StatusInternalServerError, err)
+			}
+
+			results = append(results, BatchResult{
+				Status:  rsp.Status,
+				Message: rsp.Message,
+				Payload: batchPayload(rsp.Payload),
+			})
+		}
+
+		b, err := json.Marshal(results)
+		if err != nil {
+			Logger.Error(err.Error())
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error serialising batch results: %s", err.Error()))
+		}
+
+		return Success(status, b)
+	}
+}
+
+// batchPayload returns the payload as json, encoding it as a json string if it
+// is not already valid json.
+func batchPayload(payload []byte) json.RawMessage {
+	if len(payload) == 0 || json.Valid(payload) {
+		return payload
+	}
+
+	// marshalling a string can't fail
+	b, _ := json.Marshal(string(payload))
+	return b
+}
+
+// ctxKey is the type of the keys of values in a CtxHandler's context.Context.
+type ctxKey int
+
+const (
+	txIDCtxKey ctxKey = iota
+	creatorCommonNameCtxKey
+	txTimestampCtxKey
+)
+
+// handler adapts the CtxHandler to a Handler, which derives the context from
+// the transaction.
+func (h CtxHandler) handler() Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return h(transactionContext(stub), stub, args)
+	}
+}
+
+// transactionContext derives a context.Context carrying the transaction ID,
+// and the creator's common name and transaction timestamp if they are
+// available. The context has no deadline, so it is the same on every peer.
+func transactionContext(stub shim.ChaincodeStubInterface) context.Context {
+	ctx := context.WithValue(context.Background(), txIDCtxKey, stub.GetTxID())
+
+	if cn, err := GetCreatorCommonName(stub); err == nil {
+		ctx = context.WithValue(ctx, creatorCommonNameCtxKey, cn)
+	} else {
+		Logger.Debugf("creator common name not added to context: %s", err.Error())
+	}
+
+	if ts, err := DeterministicNow(stub); err == nil {
+		ctx = context.WithValue(ctx, txTimestampCtxKey, ts)
+	}
+
+	return ctx
+}
+
+// TxIDFromContext gets the transaction ID from the context passed to a CtxHandler.
+func TxIDFromContext(ctx context.Context) (string, bool) {
+	txID, ok := ctx.Value(txIDCtxKey).(string)
+	return txID, ok
+}
+
+// CreatorCommonNameFromContext gets the common name of the transaction creator
+// from the context passed to a CtxHandler.
+func CreatorCommonNameFromContext(ctx context.Context) (string, bool) {
+	cn, ok := ctx.Value(creatorCommonNameCtxKey).(string)
+	return cn, ok
+}
+
+// TxTimestampFromContext gets the transaction timestamp from the context passed
+// to a CtxHandler.
+func TxTimestampFromContext(ctx context.Context) (time.Time, bool) {
+	ts, ok := ctx.Value(txTimestampCtxKey).(time.Time)
+	return ts, ok
+}
@@ -1,8 +1,11 @@
 package invoke
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -29,6 +32,35 @@ func TestHandlerUse(t *testing.T) {
 	deepEq(t, fmt.Sprintf("router.GetContext(stub)[%s]", key), expected, actual)
 }
 
+func TestChain(t *testing.T) {
+	router := NewRouter()
+	key := "test"
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	// run the middleware chained, and separately
+	handlers := []Handler{
+		hIntAppender(router, key, 5).use(
+			mwIntAppender(router, key, 1),
+			Chain(mwIntAppender(router, key, 2), mwIntAppender(router, key, 3)),
+			mwIntAppender(router, key, 4),
+		),
+		hIntAppender(router, key, 5).use(
+			mwIntAppender(router, key, 1),
+			mwIntAppender(router, key, 2),
+			mwIntAppender(router, key, 3),
+			mwIntAppender(router, key, 4),
+		),
+	}
+
+	for i, h := range handlers {
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+		h(stub, nil)
+		deepEq(t, fmt.Sprintf("handler %d router.GetContext(stub)[%s]", i, key), []int{1, 2, 3, 4, 5}, router.GetContext(stub)[key])
+	}
+}
+
 func mwIntAppender(router Router, contextKey string, val int) Middleware {
 	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
 		if _, ok := router.GetContext(stub)[contextKey]; !ok {
@@ -52,3 +84,98 @@ func hIntAppender(router Router, contextKey string, val int) Handler {
 		return Success(200, nil)
 	}
 }
+
+func TestTypedHandler(t *testing.T) {
+	for _, v := range jsonParserTests {
+		stub := shim.NewMockStub("test", new(testCC))
+
+		var actual *testJSON
+		h := TypedHandler(func(stub shim.ChaincodeStubInterface, value *testJSON) pb.Response {
+			actual = value
+			return Success(200, nil)
+		}, 0)
+
+		deepEq(t, "TypedHandler response", v.expectedRsp, h(stub, v.args))
+		deepEq(t, "TypedHandler value", v.expected, actual)
+	}
+}
+
+func TestRegisterCtxHandler(t *testing.T) {
+	router := NewRouter()
+	var txID, cn string
+	var ts time.Time
+	var ok [3]bool
+	router.RegisterCtxHandler("ctx", func(ctx context.Context, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		txID, ok[0] = TxIDFromContext(ctx)
+		cn, ok[1] = CreatorCommonNameFromContext(ctx)
+		ts, ok[2] = TxTimestampFromContext(ctx)
+		return Success(200, nil)
+	})
+
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user1", nil))
+	stub.MockInvoke("123", [][]byte{[]byte("ctx")})
+	stub.MockTransactionStart("123")
+	rsp := router.Invoke(stub)
+
+	eq(t, "invoke response status", int32(200), rsp.Status)
+	deepEq(t, "values found", [3]bool{true, true, true}, ok)
+	eq(t, "TxIDFromContext", "123", txID)
+	eq(t, "CreatorCommonNameFromContext", "user1", cn)
+	txTimestamp, _ := stub.GetTxTimestamp()
+	eq(t, "TxTimestampFromContext", txTimestamp.GetSeconds(), ts.Unix())
+}
+
+func TestBatchHandler(t *testing.T) {
+	itemFn := func(stub shim.ChaincodeStubInterface, item json.RawMessage) pb.Response {
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil {
+			return Error(400, "not a number")
+		}
+		if n%2 == 0 {
+			return Success(201, item)
+		}
+		return Success(200, []byte("odd"))
+	}
+
+	var tests = []struct {
+		name    string
+		handler Handler
+		args    []string
+		rsp     pb.Response
+	}{
+		{"all succeed", BatchHandler(itemFn), []string{`[2, 3]`}, Success(200, []byte(`[{"status":201,"payload":2},{"status":200,"payload":"odd"}]`))},
+		{"short circuit", BatchHandler(itemFn), []string{`[2, "a", 3]`}, Error(400, "error processing batch item 1: not a number")},
+		{"continue on error", BatchHandlerContinueOnError(itemFn), []string{`[2, "a"]`}, Success(207, []byte(`[{"status":201,"payload":2},{"status":400,"message":"not a number"}]`))},
+		{"empty batch", BatchHandler(itemFn), []string{`[]`}, Success(200, []byte(`[]`))},
+		{"invalid json", BatchHandler(itemFn), []string{`[1,`}, Error(400, "error unmarshalling json: unexpected end of JSON input")},
+		{"missing argument", BatchHandler(itemFn), nil, Error(500, "error unmarshalling json: argIndex 0 was greater than length of args")},
+	}
+
+	for _, v := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		deepEq(t, v.name+" response", v.rsp, v.handler(stub, v.args))
+	}
+}
+
+func TestBatchHandlerContinueOnErrorDiscardsWrites(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	itemFn := func(stub shim.ChaincodeStubInterface, item json.RawMessage) pb.Response {
+		var key string
+		json.Unmarshal(item, &key)
+		stub.PutState(key, item)
+		if key == "fail" {
+			return Error(400, "failed after writing")
+		}
+		return Success(200, nil)
+	}
+
+	rsp := BatchHandlerContinueOnError(itemFn)(stub, []string{`["a", "fail", "b"]`})
+	eq(t, "rsp.Status", int32(207), rsp.Status)
+
+	for key, expected := range map[string]string{"a": `"a"`, "fail": "", "b": `"b"`} {
+		value, _ := stub.GetState(key)
+		eq(t, fmt.Sprintf("GetState(%q)", key), expected, string(value))
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// HashState reads the state of each key and returns a SHA-256 digest of the
+// keys and their values, which is the same on every peer for the same ledger
+// state, for verifying a set of records from another chaincode. The order of
+// the keys doesn't matter, and duplicate keys are ignored.
+//
+// The digest is computed over the keys in ascending byte order. For each key,
+// the hash is written the length of the key as a big-endian uint64 followed by
+// the key, then a single byte which is 0 if the key does not exist, or 1
+// followed by the length of the value as a big-endian uint64 and the value if
+// it does. Values are hashed exactly as they are stored, so json values are
+// only comparable if they were written with PutCanonicalJSON.
+func HashState(stub shim.ChaincodeStubInterface, keys ...string) ([]byte, error) {
+	// sort and deduplicate the keys
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+
+	hash := sha256.New()
+	for i, key := range sorted {
+		if i > 0 && key == sorted[i-1] {
+			continue
+		}
+
+		value, err := stub.GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", key, err)
+		}
+
+		writeLengthPrefixed(hash, []byte(key))
+		if value == nil {
+			hash.Write([]byte{0})
+			continue
+		}
+		hash.Write([]byte{1})
+		writeLengthPrefixed(hash, value)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// writeLengthPrefixed writes the length of b as a big-endian uint64, then b.
+func writeLengthPrefixed(w io.Writer, b []byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(b)))
+	w.Write(length[:])
+	w.Write(b)
+}
@@ -0,0 +1,32 @@
+package invoke
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestHashState(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("a", []byte("1"))
+	stub.PutState("b", []byte("22"))
+	stub.MockTransactionEnd("123")
+
+	// a, 1, b, 22, c missing
+	expected := sha256.Sum256([]byte("" +
+		"\x00\x00\x00\x00\x00\x00\x00\x01a\x01\x00\x00\x00\x00\x00\x00\x00\x011" +
+		"\x00\x00\x00\x00\x00\x00\x00\x01b\x01\x00\x00\x00\x00\x00\x00\x00\x0222" +
+		"\x00\x00\x00\x00\x00\x00\x00\x01c\x00"))
+
+	hash, err := HashState(stub, "c", "b", "a", "b")
+	eq(t, "HashState error", nil, err)
+	eq(t, "HashState(stub, \"c\", \"b\", \"a\", \"b\")", hex.EncodeToString(expected[:]), hex.EncodeToString(hash))
+
+	other, _ := HashState(stub, "a", "b")
+	if hex.EncodeToString(other) == hex.EncodeToString(hash) {
+		t.Errorf("HashState(stub, \"a\", \"b\") should differ when a key is missing")
+	}
+}
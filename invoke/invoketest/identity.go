@@ -0,0 +1,76 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoketest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
+	"github.ibm.com/bhaesler/hyperledger-fabric-invoke-go/invoke"
+)
+
+// NewIdentity creates a protobuf encoded SerializedIdentity for the MSP, with
+// a self-signed certificate for the common name that is valid for a day either
+// side of now. If attrs is not nil, the attributes are stored in the
+// certificate the same way Fabric CA stores them, as json of the form
+// {"attrs":{"name":"value"}} in an extension with the object identifier
+// 1.2.3.4.5.6.7.8.1 (invoke.AttributeOID), so they can be read by
+// invoke.GetCreatorAttributes and checked by invoke.RequireAttribute.
+// The identity can be used with NewMockStubWithCreator. NewIdentity panics if
+// the certificate can't be created.
+func NewIdentity(mspID string, cn string, attrs map[string]string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	if attrs != nil {
+		value, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+		if err != nil {
+			panic(err)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: invoke.AttributeOID, Value: value})
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	id, err := proto.Marshal(&mspprotos.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return id
+}
@@ -0,0 +1,42 @@
+package invoketest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.ibm.com/bhaesler/hyperledger-fabric-invoke-go/invoke"
+)
+
+func TestNewIdentity(t *testing.T) {
+	router := invoke.NewRouter()
+	router.RegisterHandler("admin", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		cn, err := invoke.GetCreatorCommonName(stub)
+		if err != nil {
+			return invoke.ErrorFrom(err)
+		}
+		return invoke.Success(http.StatusOK, []byte(cn))
+	}, invoke.RequireMSP("Org1MSP"), invoke.RequireAttribute(router, "role", "admin"))
+
+	tests := []struct {
+		name     string
+		creator  []byte
+		expected int32
+	}{
+		{"admin", NewIdentity("Org1MSP", "alice", map[string]string{"role": "admin"}), http.StatusOK},
+		{"wrong attribute", NewIdentity("Org1MSP", "bob", map[string]string{"role": "user"}), http.StatusForbidden},
+		{"no attributes", NewIdentity("Org1MSP", "bob", nil), http.StatusForbidden},
+		{"wrong msp", NewIdentity("Org2MSP", "alice", map[string]string{"role": "admin"}), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		status, payload := InvokeJSONWithStub(t, NewMockStubWithCreator(&router, test.creator), "admin")
+		if status != test.expected {
+			t.Errorf("%s: expected status %d but got %d", test.name, test.expected, status)
+		}
+		if test.expected == http.StatusOK && string(payload) != "alice" {
+			t.Errorf("%s: expected payload alice but got %s", test.name, payload)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package invoketest provides helpers for testing chaincode built with an
+// invoke.Router. It is intended to be imported by tests only, so that it isn't
+// linked into production chaincode.
+package invoketest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.ibm.com/bhaesler/hyperledger-fabric-invoke-go/invoke"
+)
+
+// txCounter is used to give each invoke a unique transaction ID.
+var txCounter uint64
+
+// routerChaincode is a chaincode which passes invokes to a router. If creator
+// is set, the router sees it as the creator of every transaction.
+type routerChaincode struct {
+	router  *invoke.Router
+	creator []byte
+}
+
+// creatorStub is a stub which returns the given creator identity, as the
+// MockStub in Fabric 1.4 always returns a nil creator.
+type creatorStub struct {
+	*shim.MockStub
+	creator []byte
+}
+
+func (s creatorStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (c routerChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (c routerChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	if c.creator != nil {
+		return c.router.Invoke(creatorStub{stub.(*shim.MockStub), c.creator})
+	}
+	return c.router.Invoke(stub)
+}
+
+// NewMockStub returns a MockStub which passes invokes to the router, for tests
+// which make several invokes against the same ledger state.
+func NewMockStub(router *invoke.Router) *shim.MockStub {
+	return shim.NewMockStub("invoketest", routerChaincode{router: router})
+}
+
+// NewMockStubWithCreator returns a MockStub like NewMockStub, but the router
+// sees creator as the creator of every transaction. Use NewIdentity to create
+// the creator.
+func NewMockStubWithCreator(router *invoke.Router, creator []byte) *shim.MockStub {
+	return shim.NewMockStub("invoketest", routerChaincode{router: router, creator: creator})
+}
+
+// InvokeJSON invokes the function on the router with a new MockStub, so the
+// ledger starts empty, and returns the status and payload of the response.
+// String arguments are passed as they are, and other arguments are marshalled
+// to json. The test fails if an argument can't be marshalled.
+func InvokeJSON(t testing.TB, router *invoke.Router, function string, args ...interface{}) (status int32, payload []byte) {
+	t.Helper()
+	return InvokeJSONWithStub(t, NewMockStub(router), function, args...)
+}
+
+// InvokeJSONWithStub invokes the function like InvokeJSON, but with the given
+// stub, which should be created by NewMockStub.
+func InvokeJSONWithStub(t testing.TB, stub *shim.MockStub, function string, args ...interface{}) (status int32, payload []byte) {
+	t.Helper()
+
+	byteArgs := make([][]byte, 0, len(args)+1)
+	byteArgs = append(byteArgs, []byte(function))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			byteArgs = append(byteArgs, []byte(s))
+			continue
+		}
+
+		b, err := json.Marshal(arg)
+		if err != nil {
+			t.Fatalf("error marshalling argument %d of %s as json: %s", i, function, err.Error())
+		}
+		byteArgs = append(byteArgs, b)
+	}
+
+	txID := fmt.Sprintf("invoketest-%d", atomic.AddUint64(&txCounter, 1))
+	rsp := stub.MockInvoke(txID, byteArgs)
+	return rsp.Status, rsp.Payload
+}
+
+// DecodePayload unmarshals the json payload into valuePtr. The test fails if
+// the payload is not valid json.
+func DecodePayload(t testing.TB, payload []byte, valuePtr interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(payload, valuePtr); err != nil {
+		t.Fatalf("error unmarshalling payload %s as json: %s", payload, err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+package invoketest
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.ibm.com/bhaesler/hyperledger-fabric-invoke-go/invoke"
+)
+
+type asset struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func newTestRouter() invoke.Router {
+	router := invoke.NewRouter()
+	router.RegisterHandler("put", invoke.TypedHandler(func(stub shim.ChaincodeStubInterface, a *asset) pb.Response {
+		b, err := invoke.PutJSON(stub, a.Name, a)
+		if err != nil {
+			return invoke.ErrorFrom(err)
+		}
+		return invoke.Success(http.StatusCreated, b)
+	}, 0))
+	router.RegisterHandler("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		b, err := stub.GetState(args[0])
+		if err != nil || b == nil {
+			return invoke.Error(http.StatusNotFound, "not found")
+		}
+		return invoke.Success(http.StatusOK, b)
+	}, invoke.ArgCounter("name"))
+	return router
+}
+
+func TestInvokeJSON(t *testing.T) {
+	router := newTestRouter()
+
+	status, payload := InvokeJSON(t, &router, "put", asset{"a", 1})
+	if status != http.StatusCreated {
+		t.Errorf("put status: expected %d but got %d", http.StatusCreated, status)
+	}
+
+	var actual asset
+	DecodePayload(t, payload, &actual)
+	if !reflect.DeepEqual(asset{"a", 1}, actual) {
+		t.Errorf("put payload: expected %#v but got %#v", asset{"a", 1}, actual)
+	}
+
+	// each call to InvokeJSON starts with an empty ledger
+	if status, _ = InvokeJSON(t, &router, "get", "a"); status != http.StatusNotFound {
+		t.Errorf("get status: expected %d but got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestInvokeJSONWithStub(t *testing.T) {
+	router := newTestRouter()
+	stub := NewMockStub(&router)
+
+	InvokeJSONWithStub(t, stub, "put", asset{"a", 1})
+	status, payload := InvokeJSONWithStub(t, stub, "get", "a")
+	if status != http.StatusOK {
+		t.Errorf("get status: expected %d but got %d", http.StatusOK, status)
+	}
+
+	var actual asset
+	DecodePayload(t, payload, &actual)
+	if !reflect.DeepEqual(asset{"a", 1}, actual) {
+		t.Errorf("get payload: expected %#v but got %#v", asset{"a", 1}, actual)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// txLoggerKey is the context key under which CorrelationID stores the
+// transaction's logger.
+const txLoggerKey = ReservedKeyPrefix + "txLogger"
+
+// TxLogger is a logger which prefixes every message with values identifying
+// the transaction, such as the correlation ID stored by CorrelationID. It
+// writes to a shim.ChaincodeLogger, so it shares that logger's level.
+type TxLogger struct {
+	logger *shim.ChaincodeLogger
+	prefix string
+}
+
+// GetTxLogger gets the transaction's logger from the context. If there is none,
+// as no middleware such as CorrelationID has set one, it returns a logger
+// without a prefix which writes to the router's logger.
+func GetTxLogger(r Router, stub shim.ChaincodeStubInterface) *TxLogger {
+	if l, ok := ContextValue[*TxLogger](r, stub, txLoggerKey); ok {
+		return l
+	}
+	return &TxLogger{logger: r.log()}
+}
+
+// Debug logs the prefixed arguments at debug level.
+func (l *TxLogger) Debug(args ...interface{}) {
+	l.logger.Debug(append([]interface{}{l.prefix}, args...)...)
+}
+
+// Debugf logs the prefixed formatted message at debug level.
+func (l *TxLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug(l.prefix + fmt.Sprintf(format, args...))
+}
+
+// Info logs the prefixed arguments at info level.
+func (l *TxLogger) Info(args ...interface{}) {
+	l.logger.Info(append([]interface{}{l.prefix}, args...)...)
+}
+
+// Infof logs the prefixed formatted message at info level.
+func (l *TxLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(l.prefix + fmt.Sprintf(format, args...))
+}
+
+// Warning logs the prefixed arguments at warning level.
+func (l *TxLogger) Warning(args ...interface{}) {
+	l.logger.Warning(append([]interface{}{l.prefix}, args...)...)
+}
+
+// Warningf logs the prefixed formatted message at warning level.
+func (l *TxLogger) Warningf(format string, args ...interface{}) {
+	l.logger.Warning(l.prefix + fmt.Sprintf(format, args...))
+}
+
+// Error logs the prefixed arguments at error level.
+func (l *TxLogger) Error(args ...interface{}) {
+	l.logger.Error(append([]interface{}{l.prefix}, args...)...)
+}
+
+// Errorf logs the prefixed formatted message at error level.
+func (l *TxLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(l.prefix + fmt.Sprintf(format, args...))
+}
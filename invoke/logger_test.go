@@ -0,0 +1,24 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestGetTxLogger(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	// create the transaction context, this is normally done in router.Invoke()
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+
+	l := GetTxLogger(router, stub)
+	eq(t, "GetTxLogger(router, stub) logger without a tx logger", Logger, l.logger)
+	eq(t, "GetTxLogger(router, stub) prefix without a tx logger", "", l.prefix)
+
+	txLogger := &TxLogger{logger: Logger, prefix: "[correlationID=a] "}
+	router.GetContext(stub)[txLoggerKey] = txLogger
+	eq(t, "GetTxLogger(router, stub) with a tx logger", txLogger, GetTxLogger(router, stub))
+	txLogger.Infof("logged with prefix %d", 1)
+}
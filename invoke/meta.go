@@ -0,0 +1,170 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Methods recorded by GET, POST and DELETE, following HTTP conventions.
+const (
+	// MethodGET marks a function which only reads the ledger.
+	MethodGET = "GET"
+	// MethodPOST marks a function which writes to the ledger.
+	MethodPOST = "POST"
+	// MethodDELETE marks a function which deletes records from the ledger.
+	MethodDELETE = "DELETE"
+)
+
+// HandlerMeta describes a registered function, for documentation and tooling.
+// It does not change how the function is invoked.
+type HandlerMeta struct {
+	// Method is MethodGET, MethodPOST or MethodDELETE for functions registered
+	// with GET, POST or DELETE, or empty.
+	Method string `json:"method,omitempty"`
+	// Description is a human readable description of the function.
+	Description string `json:"description,omitempty"`
+	// Args are the names of the arguments the function expects, usually the
+	// same names passed to ArgCounter.
+	Args []string `json:"args,omitempty"`
+	// Tags group related functions, such as by the asset they act on.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// RegisterHandlerWithMeta registers a handler like RegisterHandler, and
+// attaches the metadata to the function, which is included in Describe.
+func (r *Router) RegisterHandlerWithMeta(functionName string, meta HandlerMeta, h Handler, mws ...Middleware) Handler {
+	registered := r.RegisterHandler(functionName, h, mws...)
+	r.meta[functionName] = meta
+	return registered
+}
+
+// SetMeta attaches metadata to a registered function, replacing any metadata
+// it already has, including the method recorded by GET or POST. An error is
+// returned if the function is not registered. Registering the function again
+// removes its metadata.
+func (r *Router) SetMeta(functionName string, meta HandlerMeta) error {
+	if _, ok := r.invokeMap[functionName]; !ok {
+		err := fmt.Errorf("cannot set metadata of unregistered function %s", functionName)
+		r.log().Error(err.Error())
+		return err
+	}
+
+	r.meta[functionName] = meta
+	return nil
+}
+
+// GET registers a handler like RegisterHandler, and records MethodGET as the
+// method in its metadata, marking it as a query which only reads the ledger. Use the
+// ReadOnlyGET middleware to enforce this.
+func (r *Router) GET(functionName string, h Handler, mws ...Middleware) Handler {
+	return r.RegisterHandlerWithMeta(functionName, HandlerMeta{Method: MethodGET}, h, mws...)
+}
+
+// POST registers a handler like RegisterHandler, and records MethodPOST as the
+// method in its metadata, marking it as a function which writes to the ledger.
+func (r *Router) POST(functionName string, h Handler, mws ...Middleware) Handler {
+	return r.RegisterHandlerWithMeta(functionName, HandlerMeta{Method: MethodPOST}, h, mws...)
+}
+
+// DELETE registers a handler like RegisterHandler, and records MethodDELETE as
+// the method in its metadata, marking it as a function which deletes records
+// from the ledger, usually with DeleteJSON or DeleteCascade.
+func (r *Router) DELETE(functionName string, h Handler, mws ...Middleware) Handler {
+	return r.RegisterHandlerWithMeta(functionName, HandlerMeta{Method: MethodDELETE}, h, mws...)
+}
+
+// RoutesByMethod returns a sorted list of the function names registered on the
+// router with the given method, such as MethodGET.
+func (r *Router) RoutesByMethod(method string) []string {
+	routes := make([]string, 0)
+	for functionName, meta := range r.meta {
+		if meta.Method == method {
+			routes = append(routes, functionName)
+		}
+	}
+	sort.Strings(routes)
+
+	return routes
+}
+
+// ReadOnlyGET creates a global middleware which passes a ReadOnlyStub to the
+// rest of the chain for functions registered with GET, as the ReadOnly
+// middleware does, so they can't write to the ledger. Other functions are
+// unaffected. Register it with router.Use. The function is checked by the name
+// the router resolved it to, so functions reached through an alias or the
+// default version are covered, even if they are set up after ReadOnlyGET.
+func ReadOnlyGET(router Router) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if router.meta[handlerName(router, stub)].Method == MethodGET {
+			// call next handler with the read-only stub
+			return next(ReadOnlyStub{stub}, args)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// FunctionDescriptor describes a registered function, for RouteInfo and
+// Describe.
+type FunctionDescriptor struct {
+	Name string `json:"name"`
+	HandlerMeta
+}
+
+// Describe returns a json descriptor of every function registered on the
+// router, sorted by name, with any metadata attached when it was registered,
+// for clients and SDK generators. The descriptor has the form
+//
+//	{"functions":[{"name":"getAsset","method":"GET","description":"...","args":["id"]}]}
+//
+// where empty metadata fields are omitted, as returned by RouteInfo.
+func (r *Router) Describe() []byte {
+	// marshalling structs of strings cannot fail
+	b, _ := json.Marshal(struct {
+		Functions []FunctionDescriptor `json:"functions"`
+	}{r.RouteInfo()})
+
+	return b
+}
+
+// RouteInfo returns the function names registered on the router, sorted like
+// Routes, along with their metadata. Functions without metadata have an empty
+// HandlerMeta.
+func (r *Router) RouteInfo() []FunctionDescriptor {
+	routes := r.Routes()
+	functions := make([]FunctionDescriptor, 0, len(routes))
+	for _, functionName := range routes {
+		functions = append(functions, FunctionDescriptor{Name: functionName, HandlerMeta: r.meta[functionName]})
+	}
+
+	return functions
+}
+
+// DescribeHandler returns a handler which responds with the output of Describe,
+// so clients can discover the functions of the chaincode, for example by
+// registering it under the name "__describe". The descriptor is built when the
+// handler is invoked, so it includes functions registered later.
+func (r *Router) DescribeHandler() Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(http.StatusOK, r.Describe())
+	}
+}
@@ -0,0 +1,124 @@
+package invoke
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestGETPOSTAndDELETE(t *testing.T) {
+	router := NewRouter()
+	router.Use(ReadOnlyGET(router))
+	write := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if err := stub.PutState("key", []byte("value")); err != nil {
+			return ErrorFrom(err)
+		}
+		return Success(200, nil)
+	}
+	router.GET("getAsset", write)
+	router.POST("createAsset", write)
+	router.DELETE("deleteAsset", write)
+	router.RegisterHandler("other", write)
+	router.Alias("fetchAsset", "getAsset")
+
+	deepEq(t, "router.RoutesByMethod(MethodGET)", []string{"fetchAsset", "getAsset"}, router.RoutesByMethod(MethodGET))
+	deepEq(t, "router.RoutesByMethod(MethodPOST)", []string{"createAsset"}, router.RoutesByMethod(MethodPOST))
+	deepEq(t, "router.RoutesByMethod(MethodDELETE)", []string{"deleteAsset"}, router.RoutesByMethod(MethodDELETE))
+
+	rsp := invokeRouter(&router, "1", "getAsset")
+	eq(t, "GET handler write status", int32(500), rsp.Status)
+	deepEq(t, "POST handler write response", Success(200, nil), invokeRouter(&router, "2", "createAsset"))
+	deepEq(t, "DELETE handler write response", Success(200, nil), invokeRouter(&router, "3", "deleteAsset"))
+	deepEq(t, "other handler write response", Success(200, nil), invokeRouter(&router, "4", "other"))
+
+	// re-registering a function replaces its metadata
+	router.RegisterHandler("getAsset", write)
+	deepEq(t, "router.RoutesByMethod(MethodGET) after re-registering", []string{"fetchAsset"}, router.RoutesByMethod(MethodGET))
+	deepEq(t, "re-registered handler write response", Success(200, nil), invokeRouter(&router, "5", "getAsset"))
+
+	router.Unregister("fetchAsset")
+	deepEq(t, "router.RoutesByMethod(MethodGET) after unregistering", []string{}, router.RoutesByMethod(MethodGET))
+}
+
+func TestReadOnlyGETStub(t *testing.T) {
+	router := NewRouter()
+	router.Use(ReadOnlyGET(router))
+	var err error
+	router.GET("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		err = stub.PutState("key", nil)
+		return Success(200, nil)
+	})
+
+	invokeRouter(&router, "1", "get")
+	eq(t, "errors.Is(PutState error in GET handler, ErrReadOnly)", true, errors.Is(err, ErrReadOnly))
+}
+
+func TestReadOnlyGETDefaultVersion(t *testing.T) {
+	router := NewRouter()
+	router.Use(ReadOnlyGET(router))
+	var err error
+	router.Version("v1").RegisterHandler("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		err = stub.PutState("key", nil)
+		return Success(200, nil)
+	})
+	router.SetMeta("v1/get", HandlerMeta{Method: MethodGET})
+	// the default version is set after the middleware was created
+	router.DefaultVersion("v1")
+
+	invokeRouter(&router, "1", "get")
+	eq(t, "errors.Is(PutState error in default version GET handler, ErrReadOnly)", true, errors.Is(err, ErrReadOnly))
+}
+
+func TestMountGET(t *testing.T) {
+	child := NewRouter()
+	child.GET("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	router := NewRouter()
+	router.Mount("assets.", child)
+	deepEq(t, "router.RoutesByMethod(MethodGET) after mounting", []string{"assets.get"}, router.RoutesByMethod(MethodGET))
+}
+
+func TestDescribe(t *testing.T) {
+	router := NewRouter()
+	ok := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	router.RegisterHandlerWithMeta("transfer", HandlerMeta{
+		Description: "transfers an asset to a new owner",
+		Args:        []string{"id", "owner"},
+	}, ok, ArgCounter("id", "owner"))
+	router.GET("getAsset", ok)
+	router.RegisterHandler("__describe", router.DescribeHandler())
+
+	expected := `{"functions":[` +
+		`{"name":"__describe"},` +
+		`{"name":"getAsset","method":"GET"},` +
+		`{"name":"transfer","description":"transfers an asset to a new owner","args":["id","owner"]}]}`
+	eq(t, "router.Describe()", expected, string(router.Describe()))
+	deepEq(t, "__describe response", Success(200, []byte(expected)), invokeRouter(&router, "1", "__describe"))
+}
+
+func TestSetMeta(t *testing.T) {
+	router := NewRouter()
+	ok := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	router.RegisterHandler("transfer", ok)
+	router.RegisterHandler("getAsset", ok)
+
+	meta := HandlerMeta{Description: "transfers an asset", Tags: []string{"assets"}}
+	eq(t, "router.SetMeta(\"transfer\", meta)", nil, router.SetMeta("transfer", meta))
+	notNil(t, "router.SetMeta(\"missing\", meta)", router.SetMeta("missing", meta))
+
+	deepEq(t, "router.RouteInfo()", []FunctionDescriptor{
+		{Name: "getAsset"},
+		{Name: "transfer", HandlerMeta: meta},
+	}, router.RouteInfo())
+
+	// metadata doesn't affect invocation
+	deepEq(t, "transfer response", Success(200, nil), invokeRouter(&router, "1", "transfer"))
+}
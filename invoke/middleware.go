@@ -2,42 +2,41 @@ package invoke
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
+// CreatorAttributesKey is the context key under which RequireAttribute stores
+// the creator's certificate attributes, as a map[string]string.
+const CreatorAttributesKey = ReservedKeyPrefix + "creatorAttributes"
+
+// DeadlineKey is the context key under which WithDeadline stores a
+// context.Context which is cancelled when the deadline passes.
+const DeadlineKey = ReservedKeyPrefix + "deadline"
+
 // ArgCounter takes the names of expected arguments to a handler, and returns
 // a middleware function that checks for that number of arguments.
 func ArgCounter(expected ...string) Middleware {
 	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
 		// if there is the wrong number of args
 		if len(args) != len(expected) {
-			// make a buffer for efficiency
-			var res bytes.Buffer
-			// write the start of the error
-			res.WriteString(fmt.Sprintf("incorrect number of arguments, expected %d", len(expected)))
-			// if there were expected args
-			if len(expected) > 0 {
-				res.WriteString(": ")
-				// write each argument
-				for i, arg := range expected {
-					res.WriteString(arg)
-					// add a comma if this is not the last
-					if i < len(expected)-1 {
-						res.WriteString(", ")
-					}
-				}
-			}
-
-			res.WriteString(fmt.Sprintf(", got %#v", args))
-
-			err := res.String()
+			err := argCountError(fmt.Sprintf("%d", len(expected)), expected, args)
 
 			// log and return the error
 			Logger.Error(err)
@@ -49,27 +48,206 @@ func ArgCounter(expected ...string) Middleware {
 	}
 }
 
+// ArgCounterRange takes the minimum and maximum number of arguments to a
+// handler, and the names of the arguments, and returns a middleware function
+// that checks the number of arguments is in that range. A max of -1 leaves the
+// number of arguments unbounded.
+func ArgCounterRange(min, max int, names ...string) Middleware {
+	// describe the expected range for the error message
+	var expected string
+	if max < 0 {
+		expected = fmt.Sprintf("at least %d", min)
+	} else {
+		expected = fmt.Sprintf("between %d and %d", min, max)
+	}
+
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// if the number of args is out of range
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			err := argCountError(expected, names, args)
+
+			// log and return the error
+			Logger.Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// NamedArgs creates a middleware that checks the number of arguments like
+// ArgCounter, then stores each argument in the context under the name at the
+// same position as a string, so handlers can get arguments by name rather
+// than by index.
+func NamedArgs(router Router, names ...string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// if there is the wrong number of args
+		if len(args) != len(names) {
+			err := argCountError(fmt.Sprintf("%d", len(names)), names, args)
+
+			// log and return the error
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// store each arg in the context under its name
+		ctx := router.GetContext(stub)
+		for i, name := range names {
+			ctx[name] = args[i]
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// argCountError builds the error message for an incorrect number of arguments.
+func argCountError(expected string, names []string, args []string) string {
+	// make a buffer for efficiency
+	var res bytes.Buffer
+	// write the start of the error
+	res.WriteString(fmt.Sprintf("incorrect number of arguments, expected %s", expected))
+	// if there were expected args
+	if len(names) > 0 {
+		res.WriteString(": ")
+		// write each argument
+		for i, arg := range names {
+			res.WriteString(arg)
+			// add a comma if this is not the last
+			if i < len(names)-1 {
+				res.WriteString(", ")
+			}
+		}
+	}
+
+	res.WriteString(fmt.Sprintf(", got %#v", args))
+
+	return res.String()
+}
+
 // JSONParser creates a middleware that will attempt to parse the string in the
 // specified argument position as json and store the result in the context as a pointer.
 func JSONParser(router Router, argIndex int, contextKey string, valueType reflect.Type) Middleware {
+	return jsonParser(router, argIndex, contextKey, json.Unmarshal, func() interface{} {
+		return reflect.New(valueType).Interface()
+	})
+}
+
+// JSONParserT creates a middleware that will attempt to parse the string in the
+// specified argument position as json and store the result in the context as a *T.
+func JSONParserT[T any](router Router, argIndex int, contextKey string) Middleware {
+	return jsonParser(router, argIndex, contextKey, json.Unmarshal, func() interface{} {
+		return new(T)
+	})
+}
+
+// JSONParserStrict is like JSONParser, but rejects json containing fields which
+// are not in the type with a 400, rather than silently ignoring them, so
+// clients which misspell a field get an error instead of a zero value.
+func JSONParserStrict(router Router, argIndex int, contextKey string, valueType reflect.Type) Middleware {
+	return jsonParser(router, argIndex, contextKey, unmarshalStrict, func() interface{} {
+		return reflect.New(valueType).Interface()
+	})
+}
+
+// JSONParserStrictT is the generic version of JSONParserStrict, which stores
+// the result in the context as a *T.
+func JSONParserStrictT[T any](router Router, argIndex int, contextKey string) Middleware {
+	return jsonParser(router, argIndex, contextKey, unmarshalStrict, func() interface{} {
+		return new(T)
+	})
+}
+
+// unmarshalStrict unmarshals json like json.Unmarshal, but returns an error if
+// the json contains fields which are not in valuePtr.
+func unmarshalStrict(b []byte, valuePtr interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(valuePtr); err != nil {
+		return err
+	}
+
+	// json.Unmarshal rejects anything after the value, so do the same
+	if decoder.More() {
+		return errors.New("invalid data after top-level value")
+	}
+
+	return nil
+}
+
+// JSONSpec specifies the context key and type of a json argument parsed by
+// JSONParserMulti.
+type JSONSpec struct {
+	ContextKey string
+	Type       reflect.Type
+}
+
+// JSONSpecT returns a JSONSpec which parses a json argument as a T, and stores
+// it in the context under contextKey as a *T.
+func JSONSpecT[T any](contextKey string) JSONSpec {
+	return JSONSpec{ContextKey: contextKey, Type: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+// JSONParserMulti creates a middleware that parses each argument in specs,
+// keyed by argument index, as json and stores the results in the context as
+// pointers. All of the indices are checked before any argument is parsed, and
+// the errors for every argument which fails to parse are returned together.
+func JSONParserMulti(router Router, specs map[int]JSONSpec) Middleware {
+	// parse the arguments in a consistent order
+	indices := make([]int, 0, len(specs))
+	for i := range specs {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
 	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
-		// check index is valid
-		if argIndex >= len(args) {
-			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
-			Logger.Errorf(err)
+		// check indices are valid
+		if len(indices) > 0 && indices[len(indices)-1] >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", indices[len(indices)-1])
+			router.log().Error(err)
 			return Error(http.StatusInternalServerError, fmt.Sprintf("error unmarshalling json: %s", err))
 		}
 
-		// get payload
-		b := []byte(args[argIndex])
+		// try to unmarshal each argument, collecting the errors
+		values := make(map[string]interface{}, len(indices))
+		var errs []string
+		for _, i := range indices {
+			jsonValue := reflect.New(specs[i].Type).Interface()
+			if err := json.Unmarshal([]byte(args[i]), jsonValue); err != nil {
+				errs = append(errs, fmt.Sprintf("argument %d: %s", i, err.Error()))
+				continue
+			}
+			values[specs[i].ContextKey] = jsonValue
+		}
+
+		if len(errs) > 0 {
+			err := fmt.Sprintf("error unmarshalling json: %s", strings.Join(errs, "; "))
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// store results in context
+		for k, v := range values {
+			router.GetContext(stub)[k] = v
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
 
+// jsonParser creates a middleware that parses the specified argument as json
+// with unmarshal into the pointer returned by newValue, and stores the pointer
+// in the context.
+func jsonParser(router Router, argIndex int, contextKey string, unmarshal func([]byte, interface{}) error, newValue func() interface{}) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
 		// create an object to store the value
-		jsonValue := reflect.New(valueType).Interface()
+		jsonValue := newValue()
 
 		// try to unmarshal
-		if err := json.Unmarshal(b, jsonValue); err != nil {
-			Logger.Error(err)
-			return Error(http.StatusBadRequest, fmt.Sprintf("error unmarshalling json: %s", err.Error()))
+		if err := unmarshalJSONArgWith(router.log(), args, argIndex, jsonValue, unmarshal); err != nil {
+			return ErrorFrom(err)
 		}
 
 		// store result in context
@@ -80,6 +258,36 @@ func JSONParser(router Router, argIndex int, contextKey string, valueType reflec
 	}
 }
 
+// unmarshalJSONArg unmarshals the specified argument as json into valuePtr. The
+// error returned is an InvokeError with a 500 status if the index is out of
+// range, or a 400 status if the argument is not valid json. Errors are logged
+// to logger.
+func unmarshalJSONArg(logger *shim.ChaincodeLogger, args []string, argIndex int, valuePtr interface{}) error {
+	return unmarshalJSONArgWith(logger, args, argIndex, valuePtr, json.Unmarshal)
+}
+
+// unmarshalJSONArgWith is like unmarshalJSONArg, but unmarshals the argument
+// with the given function.
+func unmarshalJSONArgWith(logger *shim.ChaincodeLogger, args []string, argIndex int, valuePtr interface{}, unmarshal func([]byte, interface{}) error) error {
+	// check index is valid
+	if argIndex >= len(args) {
+		err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+		logger.Errorf(err)
+		return Internal(fmt.Sprintf("error unmarshalling json: %s", err))
+	}
+
+	// get payload
+	b := []byte(args[argIndex])
+
+	// try to unmarshal
+	if err := unmarshal(b, valuePtr); err != nil {
+		logger.Error(err)
+		return NewInvokeError(http.StatusBadRequest, fmt.Sprintf("error unmarshalling json: %s", err.Error()), err)
+	}
+
+	return nil
+}
+
 // TimestampParser creates a middleware that will attempt to parse the string in
 // the specified argument position as a given time format and store the result
 // in the context.
@@ -88,7 +296,7 @@ func TimestampParser(router Router, argIndex int, timeFormat string, contextKey
 		// check index is valid
 		if argIndex >= len(args) {
 			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
-			Logger.Error(err)
+			router.log().Error(err)
 			return Error(http.StatusInternalServerError, fmt.Sprintf("error parsing time: %s", err))
 		}
 
@@ -96,7 +304,7 @@ func TimestampParser(router Router, argIndex int, timeFormat string, contextKey
 		var ts time.Time
 		var err error
 		if ts, err = time.Parse(timeFormat, args[argIndex]); err != nil {
-			Logger.Error(err)
+			router.log().Error(err)
 			return Error(http.StatusBadRequest, fmt.Sprintf("error parsing time string: %s", err.Error()))
 		}
 
@@ -108,6 +316,72 @@ func TimestampParser(router Router, argIndex int, timeFormat string, contextKey
 	}
 }
 
+// Formats for TimestampParserAny which parse integer Unix timestamps, which
+// time.Parse can't handle.
+const (
+	// UnixSeconds parses the number of seconds since the Unix epoch.
+	UnixSeconds = "unix"
+	// UnixMillis parses the number of milliseconds since the Unix epoch.
+	UnixMillis = "unixmilli"
+)
+
+// TimestampParserAny creates a middleware that will attempt to parse the string
+// in the specified argument position with each of the given formats in turn,
+// and store the first successful result in the context in UTC. Formats are
+// time.Parse layouts, or UnixSeconds or UnixMillis. If no formats are given,
+// time.RFC3339 is used.
+func TimestampParserAny(router Router, argIndex int, contextKey string, formats ...string) Middleware {
+	if len(formats) == 0 {
+		formats = []string{time.RFC3339}
+	}
+
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error parsing time: %s", err))
+		}
+
+		// parse timestamp with the first matching format
+		ts, ok := parseTimestamp(args[argIndex], formats)
+		if !ok {
+			err := fmt.Sprintf("error parsing time string: %q did not match any of the formats %q", args[argIndex], formats)
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// write timestamp to context
+		router.GetContext(stub)[contextKey] = ts.UTC()
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// parseTimestamp parses the string with the first of the formats which matches.
+func parseTimestamp(s string, formats []string) (time.Time, bool) {
+	for _, format := range formats {
+		switch format {
+		case UnixSeconds, UnixMillis:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				continue
+			}
+			if format == UnixSeconds {
+				return time.Unix(n, 0), true
+			}
+			return time.UnixMilli(n), true
+		default:
+			if ts, err := time.Parse(format, s); err == nil {
+				return ts, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
 // TransactionTimestamp creates a middleware that will extract the transaction
 // timestamp and store it in the context under the given key as a time.Time
 func TransactionTimestamp(router Router, contextKey string) Middleware {
@@ -116,7 +390,7 @@ func TransactionTimestamp(router Router, contextKey string) Middleware {
 		ts, err := stub.GetTxTimestamp()
 		if err != nil {
 			err = fmt.Errorf("error getting transaction timestamp: %s", err.Error())
-			Logger.Error(err)
+			router.log().Error(err)
 			return Error(http.StatusInternalServerError, err.Error())
 		}
 
@@ -127,3 +401,802 @@ func TransactionTimestamp(router Router, contextKey string) Middleware {
 		return next(stub, args)
 	}
 }
+
+// InjectNow creates a middleware that stores the transaction timestamp in UTC,
+// as returned by DeterministicNow, in the context under the given key as a
+// time.Time. Handlers should use it as the current time instead of time.Now.
+func InjectNow(router Router, contextKey string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		now, err := DeterministicNow(stub)
+		if err != nil {
+			err = fmt.Errorf("error getting transaction timestamp: %s", err.Error())
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, err.Error())
+		}
+
+		// store the timestamp in the context under the given key
+		router.GetContext(stub)[contextKey] = now
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// Recover creates a middleware that recovers from any panic in subsequent
+// middleware or the handler, logs the panic and stack trace, and returns a 500
+// error. It should be the first middleware in the global chain.
+func Recover() Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) (rsp pb.Response) {
+		defer func() {
+			if r := recover(); r != nil {
+				Logger.Errorf("recovered from panic: %v\n%s", r, debug.Stack())
+				// don't leak the details of the panic to the client
+				rsp = Error(http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// EventOnSuccess creates a middleware that emits an event with the given name
+// if the handler returns a 2xx status. The payload of the event is the result of
+// payloadFn marshalled as json. payloadFn is called after the handler, so it can
+// read values stored in the context by earlier middleware or the handler. Fabric
+// only supports a single event per transaction, so any event set by the handler
+// is replaced.
+func EventOnSuccess(name string, payloadFn func(shim.ChaincodeStubInterface, []string) interface{}) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// call next handler
+		rsp := next(stub, args)
+
+		// only emit the event if the handler succeeded
+		if rsp.Status < 200 || rsp.Status > 299 {
+			return rsp
+		}
+
+		if err := EmitEvent(stub, name, payloadFn(stub, args)); err != nil {
+			err = fmt.Errorf("error emitting event %s: %s", name, err.Error())
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err.Error())
+		}
+
+		return rsp
+	}
+}
+
+// RequireAttribute creates a middleware that rejects the transaction with a 403
+// error unless the creator's certificate has the Fabric CA attribute attrName
+// with the value attrValue. All of the creator's attributes are stored in the
+// context under CreatorAttributesKey.
+func RequireAttribute(router Router, attrName, attrValue string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// get the attributes from the creator's certificate
+		attrs, err := GetCreatorAttributes(stub)
+		if err != nil {
+			err = fmt.Errorf("error getting creator attributes: %s", err.Error())
+			router.log().Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		// check the attribute has the required value
+		if value, ok := attrs[attrName]; !ok || value != attrValue {
+			err = fmt.Errorf("creator attribute %s must be %s", attrName, attrValue)
+			router.log().Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		// store the attributes in the context
+		router.GetContext(stub)[CreatorAttributesKey] = attrs
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// RequireMSP creates a middleware that rejects the transaction with a 403 error
+// unless the creator belongs to one of the allowed MSPs.
+func RequireMSP(allowedMSPIDs ...string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// get the MSP ID from the creator's identity
+		mspID, err := GetCreatorMSPID(stub)
+		if err != nil {
+			err = fmt.Errorf("error getting creator MSP ID: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		// check the MSP is allowed
+		for _, allowed := range allowedMSPIDs {
+			if mspID == allowed {
+				// call next handler
+				return next(stub, args)
+			}
+		}
+
+		err = fmt.Errorf("creator MSP %s is not allowed, expected one of %v", mspID, allowedMSPIDs)
+		Logger.Error(err)
+		return Error(http.StatusForbidden, err.Error())
+	}
+}
+
+// RequireValidCert creates a middleware that rejects the transaction with a 403
+// error if the creator's certificate is not valid at the time of the
+// transaction. The transaction timestamp is used rather than the local clock,
+// so that all endorsing peers reach the same result.
+func RequireValidCert() Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		cert, err := GetCreatorCert(stub)
+		if err != nil {
+			err = fmt.Errorf("error getting creator certificate: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		// get the timestamp from the transaction metadata
+		ts, err := stub.GetTxTimestamp()
+		if err != nil {
+			err = fmt.Errorf("error getting transaction timestamp: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err.Error())
+		}
+		txTime := time.Unix(ts.GetSeconds(), int64(ts.GetNanos()))
+
+		// check the certificate was valid at the time of the transaction
+		if txTime.Before(cert.NotBefore) {
+			err = fmt.Errorf("creator certificate is not valid until %s", cert.NotBefore.UTC().Format(time.RFC3339))
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+		if txTime.After(cert.NotAfter) {
+			err = fmt.Errorf("creator certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// idempotencyRecord is the record stored by the Idempotent middleware.
+type idempotencyRecord struct {
+	ArgsHash string `json:"argsHash"`
+	Status   int32  `json:"status"`
+	Message  string `json:"message"`
+	Payload  []byte `json:"payload"`
+}
+
+// Idempotent creates a middleware that makes the handler idempotent using a
+// token provided by the client in the specified argument position. The first
+// successful response for a token is stored on the ledger under
+// stateKeyPrefix + token, and later invokes with the same token return the
+// stored response without calling the handler. A 409 error is returned if the
+// token is reused with a different function or arguments. Error responses are
+// not stored, as Fabric does not commit failed transactions.
+func Idempotent(tokenArgIndex int, stateKeyPrefix string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if tokenArgIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", tokenArgIndex)
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting idempotency token: %s", err))
+		}
+		key := stateKeyPrefix + args[tokenArgIndex]
+
+		// hash the function and arguments to detect reuse of the token
+		function, _ := stub.GetFunctionAndParameters()
+		argsHash, err := hashInvokeArgs(function, args)
+		if err != nil {
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error hashing arguments: %s", err.Error()))
+		}
+
+		// return the stored response if the token has been used
+		var record idempotencyRecord
+		err = GetJSON(stub, key, &record)
+		if err == nil {
+			if record.ArgsHash != argsHash {
+				err := fmt.Sprintf("idempotency token %s was already used with different arguments", args[tokenArgIndex])
+				Logger.Error(err)
+				return Error(http.StatusConflict, err)
+			}
+			return pb.Response{Status: record.Status, Message: record.Message, Payload: record.Payload}
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting idempotency record: %s", err.Error()))
+		}
+
+		// call next handler
+		rsp := next(stub, args)
+
+		// store the response if the handler succeeded
+		if rsp.Status < 400 {
+			record = idempotencyRecord{ArgsHash: argsHash, Status: rsp.Status, Message: rsp.Message, Payload: rsp.Payload}
+			if _, err = PutJSON(stub, key, record); err != nil {
+				return Error(http.StatusInternalServerError, fmt.Sprintf("error storing idempotency record: %s", err.Error()))
+			}
+		}
+
+		return rsp
+	}
+}
+
+// DedupeTxRef creates a middleware that rejects the transaction with a 409 error
+// if the reference in the specified argument position, such as the ID of an
+// earlier transaction being settled, has already been processed. Unlike
+// Idempotent, a repeated reference is an error rather than returning the
+// earlier response. After the handler succeeds, the ID of the current
+// transaction is stored on the ledger under stateKeyPrefix + reference as a
+// marker, so every peer rejects later uses of the reference.
+func DedupeTxRef(argIndex int, stateKeyPrefix string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting reference: %s", err))
+		}
+		ref := args[argIndex]
+		key := stateKeyPrefix + ref
+
+		// reject the reference if it has a marker
+		marker, err := stub.GetState(key)
+		if err != nil {
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting reference marker: %s", err.Error()))
+		}
+		if marker != nil {
+			err := fmt.Sprintf("reference %s was already processed by transaction %s", ref, marker)
+			Logger.Error(err)
+			return Error(http.StatusConflict, err)
+		}
+
+		// call next handler
+		rsp := next(stub, args)
+
+		// store the marker if the handler succeeded
+		if rsp.Status < 400 {
+			if err = stub.PutState(key, []byte(stub.GetTxID())); err != nil {
+				Logger.Error(err)
+				return Error(http.StatusInternalServerError, fmt.Sprintf("error storing reference marker: %s", err.Error()))
+			}
+		}
+
+		return rsp
+	}
+}
+
+// TransformResponse creates a middleware that passes the response of the
+// handler to fn, and returns the result, for example to wrap every payload in
+// an envelope. fn is only called if the registered handler ran, so responses
+// from middleware which returned early, such as a failed ArgCounter, are
+// returned unchanged.
+func TransformResponse(router Router, fn func(rsp pb.Response, stub shim.ChaincodeStubInterface) pb.Response) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// call next handler
+		rsp := next(stub, args)
+
+		// only transform the response if it came from the handler
+		if ran, _ := ContextValue[bool](router, stub, handlerRanKey); !ran {
+			return rsp
+		}
+
+		return fn(rsp, stub)
+	}
+}
+
+// Freezable creates a middleware that rejects invokes with a 503 error while
+// the chaincode is frozen, except for the functions named in allowed, such as
+// the function which unfreezes the chaincode. The frozen flag is read from the
+// ledger under stateKey, so every peer agrees on it, and can be set with
+// SetFrozen. As the flag is in the read set of every invoke, transactions
+// endorsed before the chaincode was frozen fail validation if they are
+// committed after it.
+func Freezable(stateKey string, allowed ...string) Middleware {
+	return flagGate(stateKey, "frozen", true, "frozen", allowed)
+}
+
+// RequireInitialized creates a middleware that rejects invokes with a 503 error
+// until the chaincode has been initialized, except for the functions named in
+// allowed, such as the function which initializes the ledger. It reads the
+// initialized flag under flagKey, set with SetInitialized once the ledger is
+// fully configured, in the same way as Freezable. Unlike Fabric's
+// --init-required, the flag is set by the application, so it can cover
+// configuration which takes several transactions.
+func RequireInitialized(flagKey string, allowed ...string) Middleware {
+	return flagGate(flagKey, "initialized", false, "not initialized", allowed)
+}
+
+// flagGate creates a middleware that rejects invokes with a 503 error while the
+// flag stored on the ledger under flagKey is equal to blockedWhen, except for
+// the functions named in allowed. name is the name of the flag, and state
+// describes the chaincode while it is blocked, for error messages.
+func flagGate(flagKey, name string, blockedWhen bool, state string, allowed []string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// allowed functions can run while blocked
+		function, _ := stub.GetFunctionAndParameters()
+		for _, a := range allowed {
+			if function == a {
+				// call next handler
+				return next(stub, args)
+			}
+		}
+
+		flag, err := getFlag(stub, flagKey)
+		if err != nil {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting %s flag: %s", name, err.Error()))
+		}
+		if flag == blockedWhen {
+			err := fmt.Sprintf("chaincode is %s, function %s is unavailable", state, function)
+			Logger.Error(err)
+			return Error(http.StatusServiceUnavailable, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// hashInvokeArgs returns the hex encoded SHA-256 hash of the json array of the
+// function name followed by its arguments.
+func hashInvokeArgs(function string, args []string) (string, error) {
+	argsJSON, err := json.Marshal(append([]string{function}, args...))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(argsJSON)), nil
+}
+
+// AccessLog creates a middleware that logs each invoke at info level in a
+// key=value format, including the function name, number of arguments, common
+// name of the creator, transaction ID, response status and the time taken by
+// the handler. The time taken is only logged, and must never be written to the
+// ledger as it differs between peers.
+func AccessLog() Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		start := time.Now()
+
+		// call next handler
+		rsp := next(stub, args)
+
+		// time.Since uses the monotonic clock, so is unaffected by clock changes
+		elapsed := time.Since(start)
+
+		function, _ := stub.GetFunctionAndParameters()
+		creator, err := GetCreatorCommonName(stub)
+		if err != nil {
+			creator = "unknown"
+		}
+
+		Logger.Infof("function=%q args=%d creator=%q txid=%q status=%d elapsed=%s",
+			function, len(args), creator, stub.GetTxID(), rsp.Status, elapsed)
+
+		return rsp
+	}
+}
+
+// WithDeadline creates a middleware that stores a context.Context which is
+// cancelled once d has passed in the context under DeadlineKey, so that long
+// running handlers, such as ones iterating over large query results, can check
+// it and abort early by returning an error. If the handler fails after the
+// deadline has passed, its response is replaced with a 504 error, so clients
+// get the same error from every handler. The deadline is advisory: the handler
+// runs to completion unless it checks the deadline, as stopping it part way
+// would leave the stub in use by a transaction which had already returned, and
+// a successful response is returned even if the deadline has passed. As the
+// deadline depends on the wall clock, endorsing peers may disagree on whether
+// it passed, so handlers should only use it to fail, never to return a partial
+// result.
+func WithDeadline(router Router, d time.Duration) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// store the deadline in the context
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		router.GetContext(stub)[DeadlineKey] = ctx
+
+		// call next handler
+		rsp := next(stub, args)
+
+		// report handlers which failed because of the deadline consistently
+		if rsp.Status >= shim.ERRORTHRESHOLD && ctx.Err() == context.DeadlineExceeded {
+			err := fmt.Sprintf("handler did not complete within %s", d)
+			router.log().Error(err)
+			return Error(http.StatusGatewayTimeout, err)
+		}
+
+		return rsp
+	}
+}
+
+// When creates a middleware that runs mw only if predicate returns true for the
+// invoked function name and its arguments, and otherwise calls the next handler
+// directly. This allows global middleware to be applied selectively, such as
+// only enforcing access control on functions which write to the ledger.
+func When(predicate func(function string, args []string) bool, mw Middleware) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// get the name of the invoked function from the stub
+		function, _ := stub.GetFunctionAndParameters()
+
+		if predicate(function, args) {
+			return mw(stub, args, next)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// GunzipMaxSize is the maximum size in bytes that Gunzip will decompress an
+// argument to, protecting the peer from compression bombs.
+var GunzipMaxSize int64 = 10 << 20
+
+// Gunzip creates a middleware which base64 decodes and gunzips the argument in
+// the specified position, replacing it with the decompressed string before
+// calling the next handler. Use it before any middleware which parses the
+// argument, such as JSONParser. Malformed base64 or gzip data, or data which
+// decompresses to more than GunzipMaxSize bytes, is rejected with a 400.
+func Gunzip(argIndex int) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error decompressing argument: %s", err))
+		}
+
+		decompressed, err := gunzipArg(args[argIndex])
+		if err != nil {
+			Logger.Error(err)
+			return Error(http.StatusBadRequest, fmt.Sprintf("error decompressing argument %d: %s", argIndex, err.Error()))
+		}
+
+		// copy the args so the caller's slice isn't modified
+		inflated := make([]string, len(args))
+		copy(inflated, args)
+		inflated[argIndex] = decompressed
+
+		// call next handler
+		return next(stub, inflated)
+	}
+}
+
+// gunzipArg base64 decodes and gunzips arg, reading at most GunzipMaxSize bytes.
+func gunzipArg(arg string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// read one byte more than the limit to detect oversized data
+	decompressed, err := io.ReadAll(io.LimitReader(reader, GunzipMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(decompressed)) > GunzipMaxSize {
+		return "", fmt.Errorf("decompressed size exceeds %d bytes", GunzipMaxSize)
+	}
+
+	return string(decompressed), nil
+}
+
+// MaxArgSize creates a middleware which rejects invokes with a 413 error if
+// any argument is larger than maxBytes, before any expensive parsing happens.
+func MaxArgSize(maxBytes int) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		for i, arg := range args {
+			if len(arg) > maxBytes {
+				return argTooLarge(i, len(arg), maxBytes)
+			}
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// MaxArgSizeAt creates a middleware which rejects invokes with a 413 error if
+// the argument in the specified position is larger than maxBytes. A missing
+// argument is not rejected, so the number of arguments should be checked
+// separately with ArgCounter.
+func MaxArgSizeAt(argIndex int, maxBytes int) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if argIndex < len(args) && len(args[argIndex]) > maxBytes {
+			return argTooLarge(argIndex, len(args[argIndex]), maxBytes)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// argTooLarge logs and returns the error response for an oversized argument.
+func argTooLarge(argIndex, size, maxBytes int) pb.Response {
+	err := fmt.Sprintf("argument %d is %d bytes, which exceeds the maximum of %d bytes", argIndex, size, maxBytes)
+	Logger.Error(err)
+	return Error(http.StatusRequestEntityTooLarge, err)
+}
+
+// CacheReadOnly creates a middleware which memoizes the response of a read-only
+// handler in the router context, keyed by the name the handler is registered
+// under and its arguments, so one CacheReadOnly middleware can be shared
+// between handlers, such as in a Chain or with router.Use. The cache only
+// lives as long as a single invoke, as caching across transactions would make
+// responses depend on which peer handled them, so it only helps when a handler
+// is called several times with the same arguments within one invoke, for
+// example a lookup handler called by several other handlers. The handler must
+// not write state, as calls answered from the cache skip it.
+func CacheReadOnly(router Router) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// key by the handler, so handlers sharing arguments don't share
+		// cached responses
+		argsHash, err := hashInvokeArgs(handlerName(router, stub), args)
+		if err != nil {
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error hashing arguments: %s", err.Error()))
+		}
+		key := ReservedKeyPrefix + "cache." + argsHash
+
+		// return the cached response if there is one
+		ctx := router.GetContext(stub)
+		if rsp, ok := ctx[key].(pb.Response); ok {
+			return rsp
+		}
+
+		// call next handler, and cache its response
+		rsp := next(stub, args)
+		ctx[key] = rsp
+
+		return rsp
+	}
+}
+
+// RequireTimeWindow creates a middleware that rejects the transaction with a 403
+// error unless its timestamp is within the window from notBefore to notAfter
+// inclusive, for time-boxed processes such as an auction. The transaction
+// timestamp is used rather than the local clock, so that all endorsing peers
+// reach the same result. A zero notBefore or notAfter leaves that end of the
+// window open.
+func RequireTimeWindow(notBefore, notAfter time.Time) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		now, err := DeterministicNow(stub)
+		if err != nil {
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error getting transaction timestamp: %s", err.Error()))
+		}
+
+		// check the transaction is within the window
+		if !notBefore.IsZero() && now.Before(notBefore) {
+			err := fmt.Sprintf("time window has not opened, it opens at %s", notBefore.UTC().Format(time.RFC3339))
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err)
+		}
+		if !notAfter.IsZero() && now.After(notAfter) {
+			err := fmt.Sprintf("time window has closed, it closed at %s", notAfter.UTC().Format(time.RFC3339))
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// CorrelationID creates a middleware which reads a client supplied correlation
+// ID in the specified argument position, for tracing a request across services,
+// and stores it in the context under contextKey. It also stores a TxLogger in
+// the context which prefixes every message with the ID, which handlers can get
+// with GetTxLogger. Only messages logged through that logger include the ID,
+// the router and the other middleware in this package log without it. The ID
+// is only used for logging, and must not be written to the ledger, as it is
+// not part of the transaction's identity. A missing ID, or one which is not a
+// UUID, is rejected with a 400.
+func CorrelationID(router Router, argIndex int, contextKey string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("correlation ID argument %d is missing", argIndex)
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+		id := args[argIndex]
+		if !uuidRegexp.MatchString(id) {
+			err := fmt.Sprintf("correlation ID %q is not a uuid", id)
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// store the ID and a logger which prefixes it in the context
+		ctx := router.GetContext(stub)
+		ctx[contextKey] = id
+		ctx[txLoggerKey] = &TxLogger{logger: router.log(), prefix: fmt.Sprintf("[correlationID=%s] ", id)}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// RequireContext creates a middleware which returns a 500 error if any of the
+// given keys are missing from the context, rather than letting the handler
+// panic on a failed type assertion. A missing key is a programming error, such
+// as middleware which sets the key being listed after this middleware, so the
+// error names the missing keys to make it easy to find during testing.
+func RequireContext(router Router, keys ...string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		ctx := router.GetContext(stub)
+		var missing []string
+		for _, key := range keys {
+			if _, ok := ctx[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+
+		if len(missing) > 0 {
+			err := fmt.Sprintf("required context keys are missing, check the order of the middleware: %s", strings.Join(missing, ", "))
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// EnumArg creates a middleware that checks the argument in the specified
+// position is one of the allowed values, and stores it in the context as a
+// string. Other values are rejected with a 400 error listing the allowed
+// values.
+func EnumArg(router Router, argIndex int, contextKey string, allowed ...string) Middleware {
+	return enumArg(router, argIndex, contextKey, allowed, func(arg string) (string, bool) {
+		for _, value := range allowed {
+			if arg == value {
+				return value, true
+			}
+		}
+		return "", false
+	})
+}
+
+// EnumArgFold is like EnumArg, but matches the argument case-insensitively,
+// and stores the matching allowed value in the context, so the handler always
+// gets the canonical spelling.
+func EnumArgFold(router Router, argIndex int, contextKey string, allowed ...string) Middleware {
+	return enumArg(router, argIndex, contextKey, allowed, func(arg string) (string, bool) {
+		for _, value := range allowed {
+			if strings.EqualFold(arg, value) {
+				return value, true
+			}
+		}
+		return "", false
+	})
+}
+
+// EnumArgAliases is like EnumArg, but maps each accepted input to a canonical
+// value, which is stored in the context. Canonical values are only accepted
+// as inputs if they are also keys of aliases.
+func EnumArgAliases(router Router, argIndex int, contextKey string, aliases map[string]string) Middleware {
+	// list the accepted inputs in a consistent order for the error message
+	allowed := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		allowed = append(allowed, alias)
+	}
+	sort.Strings(allowed)
+
+	return enumArg(router, argIndex, contextKey, allowed, func(arg string) (string, bool) {
+		value, ok := aliases[arg]
+		return value, ok
+	})
+}
+
+// enumArg creates a middleware that looks up the specified argument with
+// lookup, and stores the result in the context.
+func enumArg(router Router, argIndex int, contextKey string, allowed []string, lookup func(arg string) (string, bool)) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error parsing enum: %s", err))
+		}
+
+		value, ok := lookup(args[argIndex])
+		if !ok {
+			err := fmt.Sprintf("argument %d must be one of %s, got %q", argIndex, strings.Join(allowed, ", "), args[argIndex])
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// store result in context
+		router.GetContext(stub)[contextKey] = value
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// CompositeKeyArg creates a middleware that splits the composite key in the
+// specified argument position with SplitKeyJSON, and stores its attributes in
+// the context under contextKey as a []string. A key which is invalid or does
+// not have the expected object type is rejected with a 400 error.
+func CompositeKeyArg(router Router, argIndex int, expectedType string, contextKey string) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			router.log().Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error parsing composite key: %s", err))
+		}
+
+		objectType, attrs, err := SplitKeyJSON(stub, args[argIndex])
+		if err != nil {
+			return Error(http.StatusBadRequest, fmt.Sprintf("error parsing composite key argument %d: %s", argIndex, err.Error()))
+		}
+		if objectType != expectedType {
+			err := fmt.Sprintf("composite key argument %d must have object type %s, got %s", argIndex, expectedType, objectType)
+			router.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// store result in context
+		router.GetContext(stub)[contextKey] = attrs
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// TrimArgs creates a middleware which trims leading and trailing whitespace
+// from the arguments in the specified positions, or from every argument if no
+// positions are given, for clients which send trailing newlines. The arguments
+// are modified in place, so the change is seen by all later middleware, the
+// handler, and anything else holding the slice, such as Args. Positions past
+// the end of the arguments are ignored.
+func TrimArgs(indices ...int) Middleware {
+	return normalizeArgs(strings.TrimSpace, indices)
+}
+
+// CollapseArgs is like TrimArgs, but also replaces each run of whitespace
+// within the arguments with a single space.
+func CollapseArgs(indices ...int) Middleware {
+	return normalizeArgs(func(arg string) string {
+		return strings.Join(strings.Fields(arg), " ")
+	}, indices)
+}
+
+// normalizeArgs creates a middleware which replaces the arguments in the
+// specified positions, or every argument if none are given, with the result
+// of normalize.
+func normalizeArgs(normalize func(string) string, indices []int) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if len(indices) == 0 {
+			for i := range args {
+				args[i] = normalize(args[i])
+			}
+		}
+		for _, i := range indices {
+			if i < len(args) {
+				args[i] = normalize(args[i])
+			}
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// ShortCircuit creates a middleware which returns rsp without calling the next
+// handler, so no later middleware or the handler runs. Middleware earlier in
+// the chain still runs, and sees rsp as the response. Any middleware can
+// short-circuit in the same way by returning a response instead of calling
+// next, including a successful one, such as a cached response.
+func ShortCircuit(rsp pb.Response) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		return rsp
+	}
+}
@@ -0,0 +1,834 @@
+package invoke
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestRecover(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		var m map[string]int
+		m["panic"] = 1
+		return Success(200, nil)
+	})
+	h = h.use(Recover())
+
+	deepEq(t, "panicking handler response", Error(500, "internal server error"), h(stub, nil))
+
+	h = func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte("ok"))
+	}
+	h = h.use(Recover())
+
+	deepEq(t, "handler response", Success(200, []byte("ok")), h(stub, nil))
+}
+
+type testJSON struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+var jsonParserTests = []struct {
+	args        []string
+	expectedRsp pb.Response
+	expected    *testJSON
+}{
+	{[]string{`{"name":"a","count":1}`}, Success(200, nil), &testJSON{Name: "a", Count: 1}},
+	{[]string{`{"name":`}, Error(400, "error unmarshalling json: unexpected end of JSON input"), nil},
+	{[]string{}, Error(500, "error unmarshalling json: argIndex 0 was greater than length of args"), nil},
+}
+
+func TestNamedArgs(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("transfer", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctx := router.GetContext(stub)
+		return Success(200, []byte(ctx["assetID"].(string)+" to "+ctx["owner"].(string)))
+	}, NamedArgs(router, "assetID", "owner"))
+
+	deepEq(t, "transfer response", Success(200, []byte("a to b")), invokeRouter(&router, "1", "transfer", "a", "b"))
+	deepEq(t, "transfer response with missing arg", Error(400, `incorrect number of arguments, expected 2: assetID, owner, got []string{"a"}`), invokeRouter(&router, "2", "transfer", "a"))
+}
+
+func TestJSONParserT(t *testing.T) {
+	router := NewRouter()
+	for _, v := range jsonParserTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		var actual *testJSON
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual = router.GetContext(stub)["json"].(*testJSON)
+			return Success(200, nil)
+		})
+
+		rsp := h.use(JSONParserT[testJSON](router, 0, "json"))(stub, v.args)
+		deepEq(t, "JSONParserT response", v.expectedRsp, rsp)
+		deepEq(t, "JSONParserT context value", v.expected, actual)
+
+		// the reflect based parser should behave identically
+		actual = nil
+		rsp = h.use(JSONParser(router, 0, "json", reflect.TypeOf(testJSON{})))(stub, v.args)
+		deepEq(t, "JSONParser response", v.expectedRsp, rsp)
+		deepEq(t, "JSONParser context value", v.expected, actual)
+	}
+}
+
+var jsonParserStrictTests = []struct {
+	args           []string
+	expectedStatus int32
+	expected       *testJSON
+}{
+	{[]string{`{"name":"a","count":1}`}, 200, &testJSON{Name: "a", Count: 1}},
+	{[]string{`{"name":"a","cnt":1}`}, 400, nil},
+	{[]string{`{"name":"a"} {}`}, 400, nil},
+	{[]string{`{"name":`}, 400, nil},
+	{[]string{}, 500, nil},
+}
+
+func TestJSONParserStrict(t *testing.T) {
+	router := NewRouter()
+	for _, v := range jsonParserStrictTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		var actual *testJSON
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual = router.GetContext(stub)["json"].(*testJSON)
+			return Success(200, nil)
+		})
+
+		rsp := h.use(JSONParserStrictT[testJSON](router, 0, "json"))(stub, v.args)
+		eq(t, fmt.Sprintf("JSONParserStrictT response status for %v", v.args), v.expectedStatus, rsp.Status)
+		deepEq(t, "JSONParserStrictT context value", v.expected, actual)
+
+		// the reflect based parser should behave identically
+		actual = nil
+		rsp = h.use(JSONParserStrict(router, 0, "json", reflect.TypeOf(testJSON{})))(stub, v.args)
+		eq(t, fmt.Sprintf("JSONParserStrict response status for %v", v.args), v.expectedStatus, rsp.Status)
+		deepEq(t, "JSONParserStrict context value", v.expected, actual)
+	}
+
+	rsp := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}).use(JSONParserStrictT[testJSON](router, 0, "json"))(shim.NewMockStub("test", new(testCC)), []string{`{"cnt":1}`})
+	eq(t, "JSONParserStrictT unknown field message", `error unmarshalling json: json: unknown field "cnt"`, rsp.Message)
+}
+
+var eventOnSuccessTests = []struct {
+	status        int32
+	expectedEvent bool
+}{
+	{200, true},
+	{201, true},
+	{400, false},
+	{500, false},
+}
+
+func TestJSONParserMulti(t *testing.T) {
+	router := NewRouter()
+	mw := JSONParserMulti(router, map[int]JSONSpec{
+		0: JSONSpecT[testJSON]("first"),
+		2: {ContextKey: "second", Type: reflect.TypeOf(map[string]int{})},
+	})
+
+	var tests = []struct {
+		name string
+		args []string
+		rsp  pb.Response
+	}{
+		{"valid", []string{`{"name":"a","count":1}`, "x", `{"b":2}`}, Success(200, nil)},
+		{"missing argument", []string{`{}`, "x"}, Error(500, "error unmarshalling json: argIndex 2 was greater than length of args")},
+		{"invalid arguments", []string{`{`, "x", `[]`}, Error(400, "error unmarshalling json: argument 0: unexpected end of JSON input; argument 2: json: cannot unmarshal array into Go value of type map[string]int")},
+	}
+
+	for _, v := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			deepEq(t, v.name+" first", &testJSON{Name: "a", Count: 1}, router.GetContext(stub)["first"])
+			deepEq(t, v.name+" second", &map[string]int{"b": 2}, router.GetContext(stub)["second"])
+			return Success(200, nil)
+		})
+		deepEq(t, v.name+" response", v.rsp, h.use(mw)(stub, v.args))
+	}
+}
+
+func TestTimestampParserAny(t *testing.T) {
+	expected := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	formats := []string{time.RFC3339, "2006-01-02", UnixMillis, UnixSeconds}
+
+	var tests = []struct {
+		name     string
+		formats  []string
+		args     []string
+		rsp      pb.Response
+		expected time.Time
+	}{
+		{"first format", formats, []string{"2020-01-02T03:04:05Z"}, Success(200, nil), expected},
+		{"converted to UTC", formats, []string{"2020-01-02T13:04:05+10:00"}, Success(200, nil), expected},
+		{"second format", formats, []string{"2020-01-02"}, Success(200, nil), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"unix millis", formats, []string{"1577934245000"}, Success(200, nil), expected},
+		{"unix seconds", []string{UnixSeconds}, []string{"1577934245"}, Success(200, nil), expected},
+		{"default format", nil, []string{"2020-01-02T03:04:05Z"}, Success(200, nil), expected},
+		{"no matching format", []string{UnixSeconds}, []string{"yesterday"}, Error(400, `error parsing time string: "yesterday" did not match any of the formats ["unix"]`), time.Time{}},
+		{"missing argument", formats, nil, Error(500, "error parsing time: argIndex 0 was greater than length of args"), time.Time{}},
+	}
+
+	for _, v := range tests {
+		router := NewRouter()
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		var actual time.Time
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual = router.GetContext(stub)["ts"].(time.Time)
+			return Success(200, nil)
+		})
+
+		deepEq(t, v.name+" response", v.rsp, h.use(TimestampParserAny(router, 0, "ts", v.formats...))(stub, v.args))
+		eq(t, v.name+" value", v.expected, actual)
+	}
+}
+
+func TestInjectNow(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	// create the transaction context, this is normally done in router.Invoke()
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	ts, _ := stub.GetTxTimestamp()
+
+	var actual time.Time
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		actual = router.GetContext(stub)["now"].(time.Time)
+		return Success(200, nil)
+	})
+
+	deepEq(t, "InjectNow response", Success(200, nil), h.use(InjectNow(router, "now"))(stub, nil))
+	eq(t, "InjectNow value", time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), actual)
+}
+
+func TestEventOnSuccess(t *testing.T) {
+	for _, v := range eventOnSuccessTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			return pb.Response{Status: v.status}
+		})
+		h = h.use(EventOnSuccess("created", func(stub shim.ChaincodeStubInterface, args []string) interface{} {
+			return map[string]string{"id": args[0]}
+		}))
+
+		h(stub, []string{"a"})
+
+		select {
+		case event := <-stub.ChaincodeEventsChannel:
+			eq(t, fmt.Sprintf("status %d event emitted", v.status), v.expectedEvent, true)
+			eq(t, "event name", "created", event.EventName)
+			eq(t, "event payload", `{"id":"a"}`, string(event.Payload))
+		default:
+			eq(t, fmt.Sprintf("status %d event emitted", v.status), v.expectedEvent, false)
+		}
+	}
+}
+
+var requireAttributeTests = []struct {
+	attrs       map[string]string
+	expectedRsp pb.Response
+}{
+	{map[string]string{"role": "admin", "dept": "a"}, Success(200, nil)},
+	{map[string]string{"role": "user"}, Error(403, "creator attribute role must be admin")},
+	{map[string]string{}, Error(403, "creator attribute role must be admin")},
+	{nil, Error(403, "creator attribute role must be admin")},
+}
+
+func TestRequireAttribute(t *testing.T) {
+	router := NewRouter()
+	for _, v := range requireAttributeTests {
+		stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user", v.attrs))
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		var actual interface{}
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual = router.GetContext(stub)[CreatorAttributesKey]
+			return Success(200, nil)
+		})
+
+		rsp := h.use(RequireAttribute(router, "role", "admin"))(stub, nil)
+		deepEq(t, fmt.Sprintf("RequireAttribute response with attributes %v", v.attrs), v.expectedRsp, rsp)
+		if rsp.Status == 200 {
+			deepEq(t, "router.GetContext(stub)[CreatorAttributesKey]", v.attrs, actual)
+		}
+	}
+}
+
+var requireMSPTests = []struct {
+	mspID       string
+	expectedRsp pb.Response
+}{
+	{"Org1MSP", Success(200, nil)},
+	{"Org2MSP", Success(200, nil)},
+	{"Org3MSP", Error(403, "creator MSP Org3MSP is not allowed, expected one of [Org1MSP Org2MSP]")},
+}
+
+func TestRequireMSP(t *testing.T) {
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	h = h.use(RequireMSP("Org1MSP", "Org2MSP"))
+
+	for _, v := range requireMSPTests {
+		stub := newCreatorStub(newTestIdentity(t, v.mspID, "user", nil))
+		deepEq(t, fmt.Sprintf("RequireMSP response for %s", v.mspID), v.expectedRsp, h(stub, nil))
+	}
+}
+
+var requireValidCertTests = []struct {
+	notBefore   time.Time
+	notAfter    time.Time
+	expectedRsp pb.Response
+}{
+	{time.Now().Add(-time.Hour), time.Now().Add(time.Hour), Success(200, nil)},
+	{
+		time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2101, 1, 1, 0, 0, 0, 0, time.UTC),
+		Error(403, "creator certificate is not valid until 2100-01-01T00:00:00Z"),
+	},
+	{
+		time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+		Error(403, "creator certificate expired at 2001-01-01T00:00:00Z"),
+	},
+}
+
+func TestRequireValidCert(t *testing.T) {
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	h = h.use(RequireValidCert())
+
+	for _, v := range requireValidCertTests {
+		stub := newCreatorStub(newTestIdentityFromTemplate(t, "Org1MSP", x509.Certificate{
+			NotBefore: v.notBefore,
+			NotAfter:  v.notAfter,
+		}, nil))
+		deepEq(t, fmt.Sprintf("RequireValidCert response for %s to %s", v.notBefore, v.notAfter), v.expectedRsp, h(stub, nil))
+	}
+}
+
+var argCounterTests = []struct {
+	mw          Middleware
+	args        []string
+	expectedRsp pb.Response
+}{
+	{ArgCounter("a", "b"), []string{"1", "2"}, Success(200, nil)},
+	{ArgCounter("a", "b"), []string{"1"}, Error(400, `incorrect number of arguments, expected 2: a, b, got []string{"1"}`)},
+	{ArgCounter(), []string{"1"}, Error(400, `incorrect number of arguments, expected 0, got []string{"1"}`)},
+	{ArgCounterRange(1, 2, "a", "b"), []string{"1"}, Success(200, nil)},
+	{ArgCounterRange(1, 2, "a", "b"), []string{"1", "2"}, Success(200, nil)},
+	{ArgCounterRange(1, 2, "a", "b"), []string{}, Error(400, `incorrect number of arguments, expected between 1 and 2: a, b, got []string{}`)},
+	{ArgCounterRange(1, 2, "a", "b"), []string{"1", "2", "3"}, Error(400, `incorrect number of arguments, expected between 1 and 2: a, b, got []string{"1", "2", "3"}`)},
+	{ArgCounterRange(1, -1, "a", "b..."), []string{"1", "2", "3"}, Success(200, nil)},
+	{ArgCounterRange(1, -1, "a", "b..."), nil, Error(400, `incorrect number of arguments, expected at least 1: a, b..., got []string(nil)`)},
+}
+
+func TestArgCounter(t *testing.T) {
+	for _, v := range argCounterTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			return Success(200, nil)
+		})
+
+		deepEq(t, fmt.Sprintf("ArgCounter response for %#v", v.args), v.expectedRsp, h.use(v.mw)(stub, v.args))
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	calls := 0
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls++
+		if args[1] == "fail" {
+			return Error(400, "failed")
+		}
+		return Success(201, []byte(fmt.Sprintf("call %d", calls)))
+	})
+	h = h.use(Idempotent(0, "token_"))
+
+	deepEq(t, "first response", Success(201, []byte("call 1")), h(stub, []string{"a", "1"}))
+	deepEq(t, "repeated response", Success(201, []byte("call 1")), h(stub, []string{"a", "1"}))
+	eq(t, "handler calls", 1, calls)
+
+	deepEq(t, "conflicting response", Error(409, "idempotency token a was already used with different arguments"), h(stub, []string{"a", "2"}))
+	eq(t, "handler calls", 1, calls)
+
+	// failed responses are not stored
+	deepEq(t, "failed response", Error(400, "failed"), h(stub, []string{"b", "fail"}))
+	deepEq(t, "failed response", Error(400, "failed"), h(stub, []string{"b", "fail"}))
+	eq(t, "handler calls", 3, calls)
+
+	deepEq(t, "missing token", Error(500, "error getting idempotency token: argIndex 0 was greater than length of args"), h(stub, []string{}))
+}
+
+func TestDedupeTxRef(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	calls := 0
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls++
+		if args[1] == "fail" {
+			return Error(400, "failed")
+		}
+		return Success(200, nil)
+	})
+	h = h.use(DedupeTxRef(0, "ref_"))
+
+	stub.MockTransactionStart("1")
+	deepEq(t, "first response", Success(200, nil), h(stub, []string{"a", "1"}))
+	stub.MockTransactionEnd("1")
+	stub.MockTransactionStart("2")
+	deepEq(t, "repeated response", Error(409, "reference a was already processed by transaction 1"), h(stub, []string{"a", "1"}))
+	eq(t, "handler calls", 1, calls)
+
+	// failed responses don't store a marker
+	deepEq(t, "failed response", Error(400, "failed"), h(stub, []string{"b", "fail"}))
+	deepEq(t, "retried response", Success(200, nil), h(stub, []string{"b", "1"}))
+	eq(t, "handler calls", 3, calls)
+
+	deepEq(t, "missing reference", Error(500, "error getting reference: argIndex 0 was greater than length of args"), h(stub, []string{}))
+}
+
+func TestAccessLog(t *testing.T) {
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user", nil))
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte("ok"))
+	})
+
+	deepEq(t, "AccessLog response", Success(200, []byte("ok")), h.use(AccessLog())(stub, nil))
+}
+
+func TestWithDeadline(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+
+	var ctx context.Context
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctx = MustContextValue[context.Context](router, stub, DeadlineKey)
+		eq(t, "ctx.Err() before deadline", nil, ctx.Err())
+		return Success(200, []byte("ok"))
+	})
+	h = h.use(WithDeadline(router, time.Second))
+	deepEq(t, "fast handler response", Success(200, []byte("ok")), h(stub, nil))
+	// the deadline is cancelled once the middleware returns
+	eq(t, "ctx.Err() after return", context.Canceled, ctx.Err())
+
+	// a cooperative handler aborts once the deadline has passed, and its error
+	// is replaced with a 504
+	h = func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctx := MustContextValue[context.Context](router, stub, DeadlineKey)
+		<-ctx.Done()
+		return Error(500, "aborted")
+	}
+	h = h.use(WithDeadline(router, 10*time.Millisecond))
+	deepEq(t, "slow handler response", Error(504, "handler did not complete within 10ms"), h(stub, nil))
+
+	// a handler which succeeds after the deadline keeps its response
+	h = func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctx := MustContextValue[context.Context](router, stub, DeadlineKey)
+		<-ctx.Done()
+		return Success(200, []byte("ok"))
+	}
+	h = h.use(WithDeadline(router, 10*time.Millisecond))
+	deepEq(t, "slow successful handler response", Success(200, []byte("ok")), h(stub, nil))
+
+	// errors before the deadline are returned unchanged
+	h = func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Error(400, "bad request")
+	}
+	h = h.use(WithDeadline(router, time.Second))
+	deepEq(t, "failed handler response", Error(400, "bad request"), h(stub, nil))
+}
+
+func TestWhen(t *testing.T) {
+	router := NewRouter()
+	router.Use(When(func(function string, args []string) bool {
+		return strings.HasPrefix(function, "put")
+	}, func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		return Error(403, "forbidden")
+	}))
+	router.RegisterHandler("putAsset", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	router.RegisterHandler("getAsset", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	deepEq(t, "putAsset response", Error(403, "forbidden"), invokeRouter(&router, "1", "putAsset"))
+	deepEq(t, "getAsset response", Success(200, nil), invokeRouter(&router, "2", "getAsset"))
+}
+
+func TestTransformResponse(t *testing.T) {
+	router := NewRouter()
+	router.Use(TransformResponse(router, func(rsp pb.Response, stub shim.ChaincodeStubInterface) pb.Response {
+		rsp.Payload = []byte(fmt.Sprintf(`{"data":%s,"txId":%q}`, rsp.Payload, stub.GetTxID()))
+		return rsp
+	}))
+	router.RegisterHandler("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(`{"name":"a"}`))
+	}, ArgCounter("name"))
+
+	deepEq(t, "handler response", Success(200, []byte(`{"data":{"name":"a"},"txId":"1"}`)), invokeRouter(&router, "1", "get", "a"))
+	// the handler didn't run, so the response isn't transformed
+	eq(t, "middleware response payload", 0, len(invokeRouter(&router, "2", "get").Payload))
+}
+
+func TestFreezable(t *testing.T) {
+	router := NewRouter()
+	router.Use(Freezable("frozen", "unfreeze"))
+	ok := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	router.RegisterHandler("transfer", ok)
+	router.RegisterHandler("unfreeze", ok)
+
+	stub := shim.NewMockStub("test", new(testCC))
+	invokeFunction := func(function string) pb.Response {
+		stub.MockInvoke("123", [][]byte{[]byte(function)})
+		stub.MockTransactionStart("123")
+		return router.Invoke(stub)
+	}
+
+	deepEq(t, "transfer response before freezing", Success(200, nil), invokeFunction("transfer"))
+
+	SetFrozen(stub, "frozen", true)
+	deepEq(t, "transfer response while frozen", Error(503, "chaincode is frozen, function transfer is unavailable"), invokeFunction("transfer"))
+	deepEq(t, "unfreeze response while frozen", Success(200, nil), invokeFunction("unfreeze"))
+
+	SetFrozen(stub, "frozen", false)
+	deepEq(t, "transfer response after unfreezing", Success(200, nil), invokeFunction("transfer"))
+}
+
+func gzipBase64(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestGunzip(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("put", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(args[1]))
+	}, Gunzip(1))
+
+	deepEq(t, "compressed argument response", Success(200, []byte(`{"name":"a"}`)), invokeRouter(&router, "1", "put", "a", gzipBase64(t, `{"name":"a"}`)))
+	eq(t, "invalid base64 response status", int32(400), invokeRouter(&router, "2", "put", "a", "not base64!").Status)
+	eq(t, "invalid gzip response status", int32(400), invokeRouter(&router, "3", "put", "a", base64.StdEncoding.EncodeToString([]byte("not gzip"))).Status)
+	eq(t, "missing argument response status", int32(500), invokeRouter(&router, "4", "put", "a").Status)
+
+	defer func(max int64) { GunzipMaxSize = max }(GunzipMaxSize)
+	GunzipMaxSize = 8
+	deepEq(t, "oversized argument response", Error(400, "error decompressing argument 1: decompressed size exceeds 8 bytes"), invokeRouter(&router, "5", "put", "a", gzipBase64(t, `{"name":"a"}`)))
+}
+
+func TestMaxArgSize(t *testing.T) {
+	router := NewRouter()
+	ok := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	router.RegisterHandler("all", ok, MaxArgSize(4))
+	router.RegisterHandler("at", ok, MaxArgSizeAt(1, 4))
+
+	tests := []struct {
+		args     []string
+		expected pb.Response
+	}{
+		{[]string{"all", "a", "abcd"}, Success(200, nil)},
+		{[]string{"all", "a", "abcde"}, Error(413, "argument 1 is 5 bytes, which exceeds the maximum of 4 bytes")},
+		{[]string{"at", "abcde", "abcd"}, Success(200, nil)},
+		{[]string{"at", "a", "abcde"}, Error(413, "argument 1 is 5 bytes, which exceeds the maximum of 4 bytes")},
+		{[]string{"at", "abcde"}, Success(200, nil)},
+	}
+
+	for i, test := range tests {
+		deepEq(t, fmt.Sprintf("%v response", test.args), test.expected, invokeRouter(&router, fmt.Sprint(i), test.args...))
+	}
+}
+
+func TestCacheReadOnly(t *testing.T) {
+	router := NewRouter()
+	calls := 0
+	lookup := router.RegisterHandler("lookup", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls++
+		return Success(200, []byte(args[0]))
+	}, CacheReadOnly(router))
+	router.RegisterHandler("report", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		var payload []byte
+		for _, arg := range args {
+			payload = append(payload, lookup(stub, []string{arg}).Payload...)
+		}
+		return Success(200, payload)
+	})
+
+	deepEq(t, "report response", Success(200, []byte("aba")), invokeRouter(&router, "1", "report", "a", "b", "a"))
+	eq(t, "lookup calls", 2, calls)
+
+	// the cache doesn't outlive the invoke
+	invokeRouter(&router, "2", "report", "a")
+	eq(t, "lookup calls after second invoke", 3, calls)
+}
+
+func TestCacheReadOnlyShared(t *testing.T) {
+	router := NewRouter()
+	cache := CacheReadOnly(router)
+	first := router.RegisterHandler("first", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte("first:"+args[0]))
+	}, cache)
+	second := router.RegisterHandler("second", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte("second:"+args[0]))
+	}, cache)
+	router.RegisterHandler("report", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		payload := append(first(stub, args).Payload, ',')
+		return Success(200, append(payload, second(stub, args).Payload...))
+	})
+
+	// handlers sharing the middleware have separate cached responses
+	deepEq(t, "report response", Success(200, []byte("first:a,second:a")), invokeRouter(&router, "1", "report", "a"))
+}
+
+func TestRequireTimeWindow(t *testing.T) {
+	open := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	closed := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		mw       Middleware
+		txTime   time.Time
+		expected pb.Response
+	}{
+		{RequireTimeWindow(open, closed), open.Add(time.Hour), Success(200, nil)},
+		{RequireTimeWindow(open, closed), open, Success(200, nil)},
+		{RequireTimeWindow(open, closed), closed, Success(200, nil)},
+		{RequireTimeWindow(open, closed), open.Add(-time.Second), Error(403, "time window has not opened, it opens at 2020-01-01T00:00:00Z")},
+		{RequireTimeWindow(open, closed), closed.Add(time.Second), Error(403, "time window has closed, it closed at 2020-02-01T00:00:00Z")},
+		{RequireTimeWindow(time.Time{}, closed), open.AddDate(-10, 0, 0), Success(200, nil)},
+		{RequireTimeWindow(open, time.Time{}), closed.AddDate(10, 0, 0), Success(200, nil)},
+	}
+
+	for _, test := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		stub.TxTimestamp = &timestamp.Timestamp{Seconds: test.txTime.Unix(), Nanos: int32(test.txTime.Nanosecond())}
+
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			return Success(200, nil)
+		}).use(test.mw)
+		deepEq(t, fmt.Sprintf("RequireTimeWindow response at %s", test.txTime), test.expected, h(stub, nil))
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("test", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		id := MustContextValue[string](router, stub, "correlationID")
+		return Success(200, []byte(GetTxLogger(router, stub).prefix+id))
+	}, CorrelationID(router, 0, "correlationID"))
+
+	id := "123e4567-e89b-12d3-a456-426614174000"
+	deepEq(t, "valid correlation ID response", Success(200, []byte("[correlationID="+id+"] "+id)), invokeRouter(&router, "1", "test", id))
+	deepEq(t, "invalid correlation ID response", Error(400, `correlation ID "abc" is not a uuid`), invokeRouter(&router, "2", "test", "abc"))
+	deepEq(t, "missing correlation ID response", Error(400, "correlation ID argument 0 is missing"), invokeRouter(&router, "3", "test"))
+}
+
+func TestRequireContext(t *testing.T) {
+	router := NewRouter()
+	ok := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	router.RegisterHandler("ordered", ok, JSONParserT[testJSON](router, 0, "a"), RequireContext(router, "a"))
+	router.RegisterHandler("misordered", ok, RequireContext(router, "a", "b"), JSONParserT[testJSON](router, 0, "a"))
+
+	deepEq(t, "ordered response", Success(200, nil), invokeRouter(&router, "1", "ordered", `{}`))
+	deepEq(t, "misordered response", Error(500, "required context keys are missing, check the order of the middleware: a, b"), invokeRouter(&router, "2", "misordered", `{}`))
+}
+
+func TestEnumArg(t *testing.T) {
+	router := NewRouter()
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(MustContextValue[string](router, stub, "status")))
+	})
+
+	tests := []struct {
+		mw       Middleware
+		args     []string
+		expected pb.Response
+	}{
+		{EnumArg(router, 0, "status", "open", "closed"), []string{"open"}, Success(200, []byte("open"))},
+		{EnumArg(router, 0, "status", "open", "closed"), []string{"Open"}, Error(400, `argument 0 must be one of open, closed, got "Open"`)},
+		{EnumArg(router, 0, "status", "open", "closed"), []string{}, Error(500, "error parsing enum: argIndex 0 was greater than length of args")},
+		{EnumArgFold(router, 0, "status", "open", "closed"), []string{"CLOSED"}, Success(200, []byte("closed"))},
+		{EnumArgFold(router, 0, "status", "open", "closed"), []string{"pending"}, Error(400, `argument 0 must be one of open, closed, got "pending"`)},
+		{EnumArgAliases(router, 0, "status", map[string]string{"open": "open", "active": "open", "done": "closed"}), []string{"active"}, Success(200, []byte("open"))},
+		{EnumArgAliases(router, 0, "status", map[string]string{"open": "open", "active": "open", "done": "closed"}), []string{"closed"}, Error(400, `argument 0 must be one of active, done, open, got "closed"`)},
+	}
+
+	for _, test := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		deepEq(t, fmt.Sprintf("enum response for %v", test.args), test.expected, h.use(test.mw)(stub, test.args))
+	}
+}
+
+func TestCompositeKeyArg(t *testing.T) {
+	router := NewRouter()
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, []byte(strings.Join(MustContextValue[[]string](router, stub, "attrs"), ",")))
+	})
+	mw := CompositeKeyArg(router, 0, "owner~asset", "attrs")
+
+	tests := []struct {
+		args     []string
+		expected pb.Response
+	}{
+		{[]string{"\x00owner~asset\x00alice\x00a\x00"}, Success(200, []byte("alice,a"))},
+		{[]string{`"\u0000owner~asset\u0000bob\u0000b\u0000"`}, Success(200, []byte("bob,b"))},
+		{[]string{"\x00asset\x00a\x00"}, Error(400, "composite key argument 0 must have object type owner~asset, got asset")},
+		{[]string{"asset1"}, Error(400, `error parsing composite key argument 0: invalid composite key: "asset1"`)},
+		{[]string{}, Error(500, "error parsing composite key: argIndex 0 was greater than length of args")},
+	}
+
+	for _, test := range tests {
+		stub := shim.NewMockStub("test", new(testCC))
+		stub.MockTransactionStart("123")
+		// create the transaction context, this is normally done in router.Invoke()
+		router.context[stub.GetTxID()] = make(map[string]interface{})
+
+		deepEq(t, fmt.Sprintf("composite key response for %q", test.args), test.expected, h.use(mw)(stub, test.args))
+	}
+}
+
+func TestTrimArgs(t *testing.T) {
+	tests := []struct {
+		mw       Middleware
+		args     []string
+		expected []string
+	}{
+		{TrimArgs(), []string{" a \n", "\tb  c "}, []string{"a", "b  c"}},
+		{TrimArgs(1, 5), []string{" a ", " b "}, []string{" a ", "b"}},
+		{CollapseArgs(), []string{" a \n", "\tb \n c "}, []string{"a", "b c"}},
+		{CollapseArgs(0), []string{" a  b ", " c  d "}, []string{"a b", " c  d "}},
+	}
+
+	for _, test := range tests {
+		var actual []string
+		h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			actual = args
+			return Success(200, nil)
+		}).use(test.mw)
+
+		args := append([]string(nil), test.args...)
+		h(shim.NewMockStub("test", new(testCC)), args)
+		deepEq(t, fmt.Sprintf("handler args for %q", test.args), test.expected, actual)
+		// the args are modified in place
+		deepEq(t, fmt.Sprintf("args slice for %q", test.args), test.expected, args)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	var calls []string
+	recorder := func(name string) Middleware {
+		return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+			calls = append(calls, name+" before")
+			rsp := next(stub, args)
+			calls = append(calls, fmt.Sprintf("%s after %d", name, rsp.Status))
+			return rsp
+		}
+	}
+	cache := func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if args[0] == "cached" {
+			// return a successful response without calling the handler
+			return Success(200, []byte("cached"))
+		}
+		return next(stub, args)
+	}
+
+	router := NewRouter()
+	router.Use(recorder("global"))
+	router.RegisterHandler("get", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls = append(calls, "handler")
+		return Success(200, []byte("fresh"))
+	}, cache, recorder("handler middleware"))
+	router.RegisterHandler("maintenance", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls = append(calls, "handler")
+		return Success(200, nil)
+	}, ShortCircuit(Success(202, []byte("queued"))), recorder("handler middleware"))
+
+	deepEq(t, "cached response", Success(200, []byte("cached")), invokeRouter(&router, "1", "get", "cached"))
+	deepEq(t, "cached calls", []string{"global before", "global after 200"}, calls)
+
+	calls = nil
+	deepEq(t, "fresh response", Success(200, []byte("fresh")), invokeRouter(&router, "2", "get", "fresh"))
+	deepEq(t, "fresh calls", []string{"global before", "handler middleware before", "handler", "handler middleware after 200", "global after 200"}, calls)
+
+	calls = nil
+	deepEq(t, "ShortCircuit response", Success(202, []byte("queued")), invokeRouter(&router, "3", "maintenance"))
+	deepEq(t, "ShortCircuit calls", []string{"global before", "global after 202"}, calls)
+}
+
+func TestRequireInitialized(t *testing.T) {
+	router := NewRouter()
+	router.Use(RequireInitialized("initialized", "initLedger"))
+	router.RegisterHandler("transfer", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	router.RegisterHandler("initLedger", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if err := SetInitialized(stub, "initialized"); err != nil {
+			return ErrorFrom(err)
+		}
+		return Success(200, nil)
+	})
+
+	stub := shim.NewMockStub("test", new(testCC))
+	invokeFunction := func(txID, function string) pb.Response {
+		stub.MockInvoke(txID, [][]byte{[]byte(function)})
+		stub.MockTransactionStart(txID)
+		rsp := router.Invoke(stub)
+		stub.MockTransactionEnd(txID)
+		return rsp
+	}
+
+	deepEq(t, "transfer response before initialization", Error(503, "chaincode is not initialized, function transfer is unavailable"), invokeFunction("1", "transfer"))
+	deepEq(t, "initLedger response", Success(200, nil), invokeFunction("2", "initLedger"))
+	deepEq(t, "transfer response after initialization", Success(200, nil), invokeFunction("3", "transfer"))
+}
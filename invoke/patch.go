@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// PatchJSON applies a JSON Merge Patch (RFC 7386) to the json record stored
+// under key, writes the result back to the ledger, and returns it. Fields
+// which are not in the patch are preserved, nested objects are merged, and
+// fields set to null in the patch are removed. If the key does not exist, an
+// error wrapping ErrKeyNotFound is returned. Numbers are kept exactly as they
+// were written, and object keys are written in sorted order, so every peer
+// writes the same bytes.
+func PatchJSON(stub shim.ChaincodeStubInterface, key string, patch []byte) ([]byte, error) {
+	b, err := stub.GetState(key)
+	if err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+	if b == nil {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	target, err := decodeJSONWithNumbers(b)
+	if err != nil {
+		Logger.Errorf("error deserialising %s as json: %s", key, err.Error())
+		return nil, err
+	}
+	patchValue, err := decodeJSONWithNumbers(patch)
+	if err != nil {
+		Logger.Errorf("error deserialising patch as json: %s", err.Error())
+		return nil, err
+	}
+
+	return PutJSON(stub, key, mergePatch(target, patchValue))
+}
+
+// decodeJSONWithNumbers decodes json generically, keeping numbers as
+// json.Number so they aren't rounded to float64.
+func decodeJSONWithNumbers(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// mergePatch applies the merge patch to the target, as defined by RFC 7386.
+// The target may be modified.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		// anything other than an object replaces the target
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,50 @@
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var patchJSONTests = []struct {
+	record   string
+	patch    string
+	expected string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":{"g":1}}}`, `{"a":{"b":"c","f":{"g":1}}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+	{`{"n":12345678901234567890}`, `{"m":0.1}`, `{"m":0.1,"n":12345678901234567890}`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+}
+
+func TestPatchJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	for _, v := range patchJSONTests {
+		stub.PutState("key", []byte(v.record))
+		actual, err := PatchJSON(stub, "key", []byte(v.patch))
+		desc := fmt.Sprintf("PatchJSON(stub, \"key\", %s) on %s", v.patch, v.record)
+		eq(t, desc+" error", nil, err)
+		eq(t, desc, v.expected, string(actual))
+
+		stored, _ := stub.GetState("key")
+		eq(t, desc+" stored", v.expected, string(stored))
+	}
+
+	_, err := PatchJSON(stub, "missing", []byte(`{}`))
+	eq(t, "errors.Is(PatchJSON error with missing key, ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+
+	_, err = PatchJSON(stub, "key", []byte(`{`))
+	notNil(t, "PatchJSON error with invalid patch", err)
+}
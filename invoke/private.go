@@ -0,0 +1,109 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// PutPrivateJSON marshals the given object to json and writes it to the given
+// private data collection.
+func PutPrivateJSON(stub shim.ChaincodeStubInterface, collection, key string, value interface{}) ([]byte, error) {
+	// serialise the record as json
+	var b []byte
+	var err error
+	if b, err = json.Marshal(value); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	// write the record to the collection
+	if err = stub.PutPrivateData(collection, key, b); err != nil {
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// GetPrivateJSON retrieves a value from the given private data collection and
+// attempts to unmarshal it as json. If the key does not exist, an error wrapping
+// ErrKeyNotFound is returned.
+func GetPrivateJSON(stub shim.ChaincodeStubInterface, collection, key string, valuePtr interface{}) error {
+	var b []byte
+	var err error
+	if b, err = stub.GetPrivateData(collection, key); err != nil {
+		Logger.Errorf("error getting private data of %s from collection %s: %s", key, collection, err.Error())
+		return err
+	}
+
+	if len(b) == 0 {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		Logger.Error(err.Error())
+		return err
+	}
+
+	if err = json.Unmarshal(b, valuePtr); err != nil {
+		Logger.Errorf("error deserialising value of %s as json: %s", b, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetPrivateDataHashJSON retrieves the hash of a value in the given private
+// data collection. The hash is available on all peers, including those which
+// are not members of the collection. If the key does not exist, an error
+// wrapping ErrKeyNotFound is returned.
+func GetPrivateDataHashJSON(stub shim.ChaincodeStubInterface, collection, key string) ([]byte, error) {
+	hash, err := stub.GetPrivateDataHash(collection, key)
+	if err != nil {
+		Logger.Errorf("error getting private data hash of %s from collection %s: %s", key, collection, err.Error())
+		return nil, err
+	}
+
+	if len(hash) == 0 {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		Logger.Error(err.Error())
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+// MatchesPrivateDataHash checks whether the json encoding of the given value
+// matches the hash of the value stored in the given private data collection.
+// The value must marshal to exactly the bytes that were written, which is the
+// case for values written with PutPrivateJSON.
+func MatchesPrivateDataHash(stub shim.ChaincodeStubInterface, collection, key string, value interface{}) (bool, error) {
+	hash, err := GetPrivateDataHashJSON(stub, collection, key)
+	if err != nil {
+		return false, err
+	}
+
+	// serialise the value as it would have been written
+	var b []byte
+	if b, err = json.Marshal(value); err != nil {
+		Logger.Error(err.Error())
+		return false, err
+	}
+
+	actual := sha256.Sum256(b)
+	return bytes.Equal(hash, actual[:]), nil
+}
@@ -0,0 +1,52 @@
+package invoke
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// privateStub is a mock stub which supports private data hashes.
+type privateStub struct {
+	*shim.MockStub
+}
+
+func (s privateStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	b, err := s.GetPrivateData(collection, key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(b)
+	return hash[:], nil
+}
+
+func TestPrivateJSON(t *testing.T) {
+	stub := privateStub{shim.NewMockStub("test", new(testCC))}
+	stub.MockTransactionStart("123")
+	value := map[string]string{"name": "a"}
+
+	b, err := PutPrivateJSON(stub, "collection", "key", value)
+	eq(t, "PutPrivateJSON error", nil, err)
+	eq(t, "PutPrivateJSON json", `{"name":"a"}`, string(b))
+
+	var actual map[string]string
+	eq(t, "GetPrivateJSON error", nil, GetPrivateJSON(stub, "collection", "key", &actual))
+	deepEq(t, "GetPrivateJSON value", value, actual)
+
+	err = GetPrivateJSON(stub, "collection", "missing", &actual)
+	eq(t, "errors.Is(GetPrivateJSON(stub, \"collection\", \"missing\", &actual), ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+
+	ok, err := MatchesPrivateDataHash(stub, "collection", "key", value)
+	eq(t, "MatchesPrivateDataHash error", nil, err)
+	eq(t, "MatchesPrivateDataHash(stub, \"collection\", \"key\", value)", true, ok)
+
+	ok, err = MatchesPrivateDataHash(stub, "collection", "key", map[string]string{"name": "b"})
+	eq(t, "MatchesPrivateDataHash error", nil, err)
+	eq(t, "MatchesPrivateDataHash(stub, \"collection\", \"key\", other)", false, ok)
+
+	_, err = GetPrivateDataHashJSON(stub, "collection", "missing")
+	eq(t, "errors.Is(GetPrivateDataHashJSON(stub, \"collection\", \"missing\"), ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+}
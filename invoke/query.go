@@ -0,0 +1,345 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// GetQueryResultForQueryString executes the passed in query string.
+// Result set is built and returned as a byte array containing the JSON results.
+// Values supplied by clients must never be concatenated into the query string
+// directly, as they could add operators to the selector and match other
+// records. Use GetQueryResultForSelector or Query instead, or at least
+// EscapeQueryValue.
+func GetQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+
+	Logger.Debugf("getQueryResultForQueryString queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result, err := queryResultsToJSON(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	Logger.Debugf("- getQueryResultForQueryString queryResult:\n%s\n", result)
+
+	return result, nil
+}
+
+// GetQueryResultSorted executes the passed in query string like
+// GetQueryResultForQueryString, but sorts the results by key before building
+// the json. CouchDB only returns results in a stable order if the query
+// specifies a sort, so use GetQueryResultSorted when the result is hashed,
+// written to the ledger or emitted in an event, so that every peer produces
+// the same bytes. All of the results are held in memory while sorting.
+func GetQueryResultSorted(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+
+	Logger.Debugf("getQueryResultSorted queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var results []*queryresult.KV
+	err = iterateQueryResults(resultsIterator, func(key string, record []byte) error {
+		results = append(results, &queryresult.KV{Key: key, Value: record})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+
+	return queryResultsToJSON(&kvIterator{results})
+}
+
+// GetQueryResultForSelector executes a query with the given CouchDB selector,
+// returning the results in the same format as GetQueryResultForQueryString.
+// The selector is marshalled to json, so values supplied by clients can be
+// used in it safely, as long as they are not used as keys.
+func GetQueryResultForSelector(stub shim.ChaincodeStubInterface, selector map[string]interface{}) ([]byte, error) {
+	if selector == nil {
+		selector = map[string]interface{}{}
+	}
+
+	b, err := json.Marshal(couchQuery{Selector: selector})
+	if err != nil {
+		Logger.Errorf("error serialising selector as json: %s", err.Error())
+		return nil, err
+	}
+
+	return GetQueryResultForQueryString(stub, string(b))
+}
+
+// EscapeQueryValue escapes a string for use inside a json string in a query
+// string, so that it can't end the string and add operators to the query. The
+// surrounding quotes are not included.
+func EscapeQueryValue(s string) string {
+	// marshalling a string can't fail
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// GetQueryResultWithPagination executes the passed in query string, fetching a
+// single page of at most pageSize results starting from the given bookmark. An
+// empty bookmark fetches the first page. The results are returned in the same
+// format as GetQueryResultForQueryString, along with the bookmark to pass to
+// the next call to fetch the following page.
+//
+// The returned bookmark has the form "<count>:<bookmark>", where count is the
+// number of records fetched, as reported by the peer, and bookmark is the
+// peer's bookmark for the next page. ParsePageBookmark splits it into these
+// parts. Only empty bookmarks and bookmarks returned by this function may be
+// passed in. A page with fewer than pageSize records is not necessarily the
+// last one, so keep fetching until a page is empty.
+func GetQueryResultWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, string, error) {
+	if bookmark != "" {
+		var err error
+		if _, bookmark, err = ParsePageBookmark(bookmark); err != nil {
+			return nil, "", err
+		}
+	}
+
+	result, metadata, err := getQueryResultWithPagination(stub, queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, strconv.Itoa(int(metadata.GetFetchedRecordsCount())) + ":" + metadata.GetBookmark(), nil
+}
+
+// ErrInvalidBookmark is returned by ParsePageBookmark for a bookmark which was
+// not returned by GetQueryResultWithPagination.
+var ErrInvalidBookmark = errors.New("invalid bookmark")
+
+// ParsePageBookmark splits a bookmark returned by GetQueryResultWithPagination
+// into the number of records fetched in that page and the peer's bookmark for
+// the next page. An error wrapping ErrInvalidBookmark is returned for any
+// other string.
+func ParsePageBookmark(bookmark string) (count int32, next string, err error) {
+	i := strings.Index(bookmark, ":")
+	if i < 0 {
+		return 0, "", fmt.Errorf("%w: %q", ErrInvalidBookmark, bookmark)
+	}
+
+	n, err := strconv.ParseInt(bookmark[:i], 10, 32)
+	if err != nil || n < 0 {
+		return 0, "", fmt.Errorf("%w: %q", ErrInvalidBookmark, bookmark)
+	}
+
+	return int32(n), bookmark[i+1:], nil
+}
+
+// ListResponse is the json envelope returned by list functions built with
+// GetListResponse, giving clients the same shape for every list. Records is
+// the json array of { Key, Record } objects described in
+// GetQueryResultForQueryString, Bookmark is passed back to fetch the next page,
+// and is empty after the last page, and Count is the number of records in this
+// page.
+type ListResponse struct {
+	Records  json.RawMessage `json:"records"`
+	Bookmark string          `json:"bookmark"`
+	Count    int32           `json:"count"`
+}
+
+// GetListResponse executes the passed in query string like
+// GetQueryResultWithPagination, and returns the page as a ListResponse
+// marshalled to json, for use in invoke.Success payloads.
+func GetListResponse(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, error) {
+	result, metadata, err := getQueryResultWithPagination(stub, queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(ListResponse{
+		Records:  result,
+		Bookmark: metadata.GetBookmark(),
+		Count:    metadata.GetFetchedRecordsCount(),
+	})
+	if err != nil {
+		Logger.Errorf("error serialising list response as json: %s", err.Error())
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// getQueryResultWithPagination executes a paginated query, and returns the
+// results as json along with the query response metadata.
+func getQueryResultWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, *pb.QueryResponseMetadata, error) {
+
+	Logger.Debugf("getQueryResultWithPagination queryString:\n%s\npageSize: %d, bookmark: %s\n", queryString, pageSize, bookmark)
+
+	resultsIterator, metadata, err := stub.GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultsIterator.Close()
+
+	result, err := queryResultsToJSON(resultsIterator)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	Logger.Debugf("- getQueryResultWithPagination queryResult:\n%s\nfetched: %d, bookmark: %s\n", result, metadata.GetFetchedRecordsCount(), metadata.GetBookmark())
+
+	return result, metadata, nil
+}
+
+// GetStateByRangeJSON gets the records with keys in the range from startKey
+// (inclusive) to endKey (exclusive), returned in the same format as
+// GetQueryResultForQueryString. An empty startKey or endKey leaves that end of
+// the range unbounded. If the range is empty, an empty json array is returned.
+func GetStateByRangeJSON(stub shim.ChaincodeStubInterface, startKey, endKey string) ([]byte, error) {
+
+	Logger.Debugf("getStateByRangeJSON startKey: %s, endKey: %s\n", startKey, endKey)
+
+	// the end key is exclusive, so the range is empty if it is not after the start key
+	if startKey != "" && endKey != "" && startKey >= endKey {
+		return []byte("[]"), nil
+	}
+
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return queryResultsToJSON(resultsIterator)
+}
+
+// GetStateByPartialCompositeKeyJSON gets the records with composite keys of the
+// given object type, starting with the given attributes, returned in the same
+// format as GetQueryResultForQueryString.
+func GetStateByPartialCompositeKeyJSON(stub shim.ChaincodeStubInterface, objectType string, attributes []string) ([]byte, error) {
+
+	Logger.Debugf("getStateByPartialCompositeKeyJSON objectType: %s, attributes: %v\n", objectType, attributes)
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return queryResultsToJSON(resultsIterator)
+}
+
+// StreamQueryResult executes the passed in query string, and calls emit with
+// the key and record of each result in turn, without buffering the result set.
+// Iteration stops at the first error returned by emit, which is then returned.
+func StreamQueryResult(stub shim.ChaincodeStubInterface, queryString string, emit func(key string, record []byte) error) error {
+
+	Logger.Debugf("streamQueryResult queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	return iterateQueryResults(resultsIterator, emit)
+}
+
+// iterateQueryResults calls emit with the key and value of each result in the
+// iterator, stopping at the first error.
+func iterateQueryResults(resultsIterator shim.StateQueryIteratorInterface, emit func(key string, record []byte) error) error {
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		if err = emit(queryResponse.Key, queryResponse.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kvIterator is a query iterator over a slice of results.
+type kvIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *kvIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *kvIterator) Next() (*queryresult.KV, error) {
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *kvIterator) Close() error {
+	return nil
+}
+
+// queryResultsToJSON builds a JSON array of { Key, Record } objects from the
+// results in the iterator.
+func queryResultsToJSON(resultsIterator shim.StateQueryIteratorInterface) ([]byte, error) {
+	// buffer is a JSON array containing QueryRecords
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	err := iterateQueryResults(resultsIterator, func(key string, record []byte) error {
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"Key\":")
+		// keys may contain characters which must be escaped, such as the
+		// separators in composite keys
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		buffer.Write(keyJSON)
+
+		buffer.WriteString(", \"Record\":")
+		// Record is a JSON object, so we write as-is
+		buffer.WriteString(string(record))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	buffer.WriteString("]")
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,266 @@
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// queryStub is a mock stub which supports rich queries by returning every
+// record on the ledger, regardless of the query string.
+type queryStub struct {
+	*shim.MockStub
+}
+
+func (s queryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return s.GetStateByRange("", "")
+}
+
+// GetQueryResultWithPagination returns a page of every record on the ledger,
+// using the key of the first record in the page as the bookmark.
+func (s queryStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, err := s.GetStateByRange("", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+
+	page := &kvIterator{}
+	nextBookmark := ""
+	for it.HasNext() {
+		kv, _ := it.Next()
+		if kv.Key < bookmark {
+			continue
+		}
+		if int32(len(page.kvs)) == pageSize {
+			nextBookmark = kv.Key
+			break
+		}
+		page.kvs = append(page.kvs, kv)
+	}
+
+	return page, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(page.kvs)), Bookmark: nextBookmark}, nil
+}
+
+func newQueryStub() queryStub {
+	stub := queryStub{shim.NewMockStub("test", new(testCC))}
+	stub.MockTransactionStart("123")
+	return stub
+}
+
+// unorderedQueryStub is a mock stub which supports rich queries by returning
+// every record on the ledger in reverse key order.
+type unorderedQueryStub struct {
+	*shim.MockStub
+}
+
+func (s unorderedQueryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	results := &kvIterator{}
+	for it.HasNext() {
+		kv, _ := it.Next()
+		results.kvs = append([]*queryresult.KV{kv}, results.kvs...)
+	}
+	return results, nil
+}
+
+func TestGetQueryResultSorted(t *testing.T) {
+	stub := unorderedQueryStub{shim.NewMockStub("test", new(testCC))}
+	stub.MockTransactionStart("123")
+
+	actual, err := GetQueryResultSorted(stub, "{}")
+	eq(t, "GetQueryResultSorted error", nil, err)
+	eq(t, "GetQueryResultSorted(stub, \"{}\")", "[]", string(actual))
+
+	stub.PutState("b", []byte(`{"name":"b"}`))
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("c", []byte(`{"name":"c"}`))
+
+	unsorted, _ := GetQueryResultForQueryString(stub, "{}")
+	eq(t, "GetQueryResultForQueryString(stub, \"{}\")",
+		`[{"Key":"c", "Record":{"name":"c"}},{"Key":"b", "Record":{"name":"b"}},{"Key":"a", "Record":{"name":"a"}}]`, string(unsorted))
+
+	actual, err = GetQueryResultSorted(stub, "{}")
+	eq(t, "GetQueryResultSorted error", nil, err)
+	eq(t, "GetQueryResultSorted(stub, \"{}\")",
+		`[{"Key":"a", "Record":{"name":"a"}},{"Key":"b", "Record":{"name":"b"}},{"Key":"c", "Record":{"name":"c"}}]`, string(actual))
+}
+
+func TestGetQueryResultForQueryString(t *testing.T) {
+	stub := newQueryStub()
+
+	actual, err := GetQueryResultForQueryString(stub, "{}")
+	eq(t, "GetQueryResultForQueryString error", nil, err)
+	eq(t, "GetQueryResultForQueryString(stub, \"{}\")", "[]", string(actual))
+
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`{"name":"b"}`))
+
+	actual, err = GetQueryResultForQueryString(stub, "{}")
+	eq(t, "GetQueryResultForQueryString error", nil, err)
+	eq(t, "GetQueryResultForQueryString(stub, \"{}\")",
+		`[{"Key":"a", "Record":{"name":"a"}},{"Key":"b", "Record":{"name":"b"}}]`, string(actual))
+}
+
+func TestStreamQueryResult(t *testing.T) {
+	stub := newQueryStub()
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`{"name":"b"}`))
+
+	keys := make([]string, 0)
+	err := StreamQueryResult(stub, "{}", func(key string, record []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	eq(t, "StreamQueryResult error", nil, err)
+	deepEq(t, "emitted keys", []string{"a", "b"}, keys)
+
+	// an error from emit should stop the iteration and be returned
+	emitErr := errors.New("emit error")
+	keys = make([]string, 0)
+	err = StreamQueryResult(stub, "{}", func(key string, record []byte) error {
+		keys = append(keys, key)
+		return emitErr
+	})
+	eq(t, "StreamQueryResult error", emitErr, err)
+	deepEq(t, "emitted keys", []string{"a"}, keys)
+}
+
+func TestGetQueryResultWithPagination(t *testing.T) {
+	stub := newQueryStub()
+
+	actual, bookmark, err := GetQueryResultWithPagination(stub, "{}", 2, "")
+	eq(t, "GetQueryResultWithPagination error", nil, err)
+	eq(t, "GetQueryResultWithPagination result", "[]", string(actual))
+	eq(t, "GetQueryResultWithPagination bookmark", "0:", bookmark)
+
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`{"name":"b"}`))
+	stub.PutState("c", []byte(`{"name":"c"}`))
+
+	actual, bookmark, err = GetQueryResultWithPagination(stub, "{}", 2, "")
+	eq(t, "GetQueryResultWithPagination error", nil, err)
+	eq(t, "GetQueryResultWithPagination result",
+		`[{"Key":"a", "Record":{"name":"a"}},{"Key":"b", "Record":{"name":"b"}}]`, string(actual))
+	eq(t, "GetQueryResultWithPagination bookmark", "2:c", bookmark)
+
+	actual, bookmark, err = GetQueryResultWithPagination(stub, "{}", 2, bookmark)
+	eq(t, "GetQueryResultWithPagination error", nil, err)
+	eq(t, "GetQueryResultWithPagination result", `[{"Key":"c", "Record":{"name":"c"}}]`, string(actual))
+	eq(t, "GetQueryResultWithPagination bookmark", "1:", bookmark)
+
+	// a page past the end is empty
+	actual, bookmark, err = GetQueryResultWithPagination(stub, "{}", 2, "0:d")
+	eq(t, "GetQueryResultWithPagination error", nil, err)
+	eq(t, "GetQueryResultWithPagination result", "[]", string(actual))
+	eq(t, "GetQueryResultWithPagination bookmark", "0:", bookmark)
+
+	_, _, err = GetQueryResultWithPagination(stub, "{}", 2, "c")
+	eq(t, "GetQueryResultWithPagination invalid bookmark", true, errors.Is(err, ErrInvalidBookmark))
+}
+
+func TestParsePageBookmark(t *testing.T) {
+	count, next, err := ParsePageBookmark("2:c:d")
+	eq(t, "ParsePageBookmark error", nil, err)
+	eq(t, "ParsePageBookmark count", int32(2), count)
+	eq(t, "ParsePageBookmark next", "c:d", next)
+
+	count, next, err = ParsePageBookmark("0:")
+	eq(t, "ParsePageBookmark error", nil, err)
+	eq(t, "ParsePageBookmark count", int32(0), count)
+	eq(t, "ParsePageBookmark next", "", next)
+
+	for _, bookmark := range []string{"", "c", "x:c", "-1:c"} {
+		_, _, err = ParsePageBookmark(bookmark)
+		eq(t, "ParsePageBookmark("+bookmark+") error", true, errors.Is(err, ErrInvalidBookmark))
+	}
+}
+
+func TestGetListResponse(t *testing.T) {
+	stub := newQueryStub()
+
+	actual, err := GetListResponse(stub, "{}", 2, "")
+	eq(t, "GetListResponse error", nil, err)
+	eq(t, "GetListResponse result", `{"records":[],"bookmark":"","count":0}`, string(actual))
+
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`{"name":"b"}`))
+	stub.PutState("c", []byte(`{"name":"c"}`))
+
+	actual, err = GetListResponse(stub, "{}", 2, "")
+	eq(t, "GetListResponse error", nil, err)
+	eq(t, "GetListResponse result",
+		`{"records":[{"Key":"a","Record":{"name":"a"}},{"Key":"b","Record":{"name":"b"}}],"bookmark":"c","count":2}`, string(actual))
+
+	actual, err = GetListResponse(stub, "{}", 2, "c")
+	eq(t, "GetListResponse error", nil, err)
+	eq(t, "GetListResponse result", `{"records":[{"Key":"c","Record":{"name":"c"}}],"bookmark":"","count":1}`, string(actual))
+}
+
+func TestGetStateByRangeJSON(t *testing.T) {
+	stub := newQueryStub()
+
+	actual, err := GetStateByRangeJSON(stub, "", "")
+	eq(t, "GetStateByRangeJSON error", nil, err)
+	eq(t, "GetStateByRangeJSON(stub, \"\", \"\")", "[]", string(actual))
+
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`{"name":"b"}`))
+
+	actual, err = GetStateByRangeJSON(stub, "", "")
+	eq(t, "GetStateByRangeJSON error", nil, err)
+	eq(t, "GetStateByRangeJSON(stub, \"\", \"\")",
+		`[{"Key":"a", "Record":{"name":"a"}},{"Key":"b", "Record":{"name":"b"}}]`, string(actual))
+
+	for _, r := range [][]string{{"b", "a"}, {"a", "a"}} {
+		actual, err = GetStateByRangeJSON(stub, r[0], r[1])
+		eq(t, "GetStateByRangeJSON error", nil, err)
+		eq(t, fmt.Sprintf("GetStateByRangeJSON(stub, %#v, %#v)", r[0], r[1]), "[]", string(actual))
+	}
+}
+
+func TestGetStateByPartialCompositeKeyJSON(t *testing.T) {
+	stub := newQueryStub()
+
+	actual, err := GetStateByPartialCompositeKeyJSON(stub, "owner~asset", []string{"alice"})
+	eq(t, "GetStateByPartialCompositeKeyJSON error", nil, err)
+	eq(t, "GetStateByPartialCompositeKeyJSON(stub, \"owner~asset\", []string{\"alice\"})", "[]", string(actual))
+
+	key, b, err := PutJSONComposite(stub, "owner~asset", []string{"alice", "a"}, map[string]string{"name": "a"})
+	eq(t, "PutJSONComposite error", nil, err)
+	eq(t, "PutJSONComposite key", "\x00owner~asset\x00alice\x00a\x00", key)
+	eq(t, "PutJSONComposite json", `{"name":"a"}`, string(b))
+	PutJSONComposite(stub, "owner~asset", []string{"bob", "b"}, map[string]string{"name": "b"})
+
+	actual, err = GetStateByPartialCompositeKeyJSON(stub, "owner~asset", []string{"alice"})
+	eq(t, "GetStateByPartialCompositeKeyJSON error", nil, err)
+	eq(t, "GetStateByPartialCompositeKeyJSON(stub, \"owner~asset\", []string{\"alice\"})",
+		`[{"Key":"\u0000owner~asset\u0000alice\u0000a\u0000", "Record":{"name":"a"}}]`, string(actual))
+}
+
+func TestGetQueryResultForSelector(t *testing.T) {
+	stub := newQueryStub()
+	stub.PutState("a", []byte(`{"owner":"x"}`))
+
+	b, err := GetQueryResultForSelector(stub, map[string]interface{}{"owner": "x"})
+	eq(t, "GetQueryResultForSelector error", nil, err)
+	eq(t, "GetQueryResultForSelector", `[{"Key":"a", "Record":{"owner":"x"}}]`, string(b))
+
+	_, err = GetQueryResultForSelector(stub, map[string]interface{}{"owner": func() {}})
+	notNil(t, "GetQueryResultForSelector error with invalid value", err)
+}
+
+func TestEscapeQueryValue(t *testing.T) {
+	eq(t, "EscapeQueryValue(plain)", "abc", EscapeQueryValue("abc"))
+	eq(t, "EscapeQueryValue(injection)", `x\", \"$gt\": \"`, EscapeQueryValue(`x", "$gt": "`))
+	eq(t, "EscapeQueryValue(control characters)", `a\nb\\`, EscapeQueryValue("a\nb\\"))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Sort directions for QueryBuilder.Sort.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// QueryBuilder builds CouchDB query strings for GetQueryResultForQueryString.
+// Values in the selector are encoded as json, so untrusted values can be used
+// safely, but they must never be used as keys, as keys beginning with "$" are
+// operators.
+type QueryBuilder struct {
+	query couchQuery
+}
+
+// couchQuery is the json structure of a CouchDB query.
+type couchQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []map[string]string    `json:"sort,omitempty"`
+	Limit    int                    `json:"limit,omitempty"`
+	Skip     int                    `json:"skip,omitempty"`
+	Fields   []string               `json:"fields,omitempty"`
+}
+
+// Query returns a new QueryBuilder, which matches every record until a
+// selector is set.
+func Query() *QueryBuilder {
+	return &QueryBuilder{
+		query: couchQuery{Selector: map[string]interface{}{}},
+	}
+}
+
+// Selector sets the selector of the query, which may use CouchDB operators such
+// as "$gt" and "$in" in nested maps, for example:
+//
+//	map[string]interface{}{"owner": owner, "value": map[string]interface{}{"$gt": 10}}
+func (q *QueryBuilder) Selector(selector map[string]interface{}) *QueryBuilder {
+	if selector == nil {
+		selector = map[string]interface{}{}
+	}
+	q.query.Selector = selector
+	return q
+}
+
+// Sort adds a field to sort the results by, in the direction SortAsc or
+// SortDesc. Fields are sorted by in the order they are added.
+func (q *QueryBuilder) Sort(field, direction string) *QueryBuilder {
+	q.query.Sort = append(q.query.Sort, map[string]string{field: direction})
+	return q
+}
+
+// Limit sets the maximum number of results returned.
+func (q *QueryBuilder) Limit(n int) *QueryBuilder {
+	q.query.Limit = n
+	return q
+}
+
+// Skip sets the number of results skipped before the first result returned.
+func (q *QueryBuilder) Skip(n int) *QueryBuilder {
+	q.query.Skip = n
+	return q
+}
+
+// Fields sets the fields of each record which are returned.
+func (q *QueryBuilder) Fields(fields ...string) *QueryBuilder {
+	q.query.Fields = fields
+	return q
+}
+
+// Build returns the query as a json string. Build panics if the selector
+// contains a value which can't be marshalled to json, such as a func.
+func (q *QueryBuilder) Build() string {
+	b, err := json.Marshal(q.query)
+	if err != nil {
+		panic(fmt.Sprintf("error building query: %s", err.Error()))
+	}
+
+	return string(b)
+}
@@ -0,0 +1,51 @@
+package invoke
+
+import (
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	var tests = []struct {
+		name     string
+		query    *QueryBuilder
+		expected string
+	}{
+		{"empty", Query(), `{"selector":{}}`},
+		{"nil selector", Query().Selector(nil), `{"selector":{}}`},
+		{
+			"nested operators",
+			Query().Selector(map[string]interface{}{
+				"docType": "asset",
+				"value":   map[string]interface{}{"$gt": 10},
+				"$or": []interface{}{
+					map[string]interface{}{"owner": map[string]interface{}{"$in": []string{"a", "b"}}},
+					map[string]interface{}{"public": true},
+				},
+			}),
+			`{"selector":{"$or":[{"owner":{"$in":["a","b"]}},{"public":true}],"docType":"asset","value":{"$gt":10}}}`,
+		},
+		{
+			"special characters escaped",
+			Query().Selector(map[string]interface{}{"owner": `a", "$gt": "`}),
+			`{"selector":{"owner":"a\", \"$gt\": \""}}`,
+		},
+		{
+			"sort, limit, skip and fields",
+			Query().Selector(map[string]interface{}{"docType": "asset"}).Sort("owner", SortAsc).Sort("value", SortDesc).Limit(10).Skip(5).Fields("owner", "value"),
+			`{"selector":{"docType":"asset"},"sort":[{"owner":"asc"},{"value":"desc"}],"limit":10,"skip":5,"fields":["owner","value"]}`,
+		},
+	}
+
+	for _, v := range tests {
+		eq(t, v.name, v.expected, v.query.Build())
+	}
+}
+
+func TestQueryBuilderInvalidValue(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Build() with invalid value did not panic")
+		}
+	}()
+	Query().Selector(map[string]interface{}{"f": func() {}}).Build()
+}
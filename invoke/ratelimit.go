@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// rateLimitObjectType is the object type of the composite keys of the counters
+// stored by RateLimitPerIdentity.
+const rateLimitObjectType = "invoke.rateLimit"
+
+// TimestampWindow returns a function for RateLimitPerIdentity which gets the
+// transaction timestamp truncated to a multiple of d, such as an hour, so that
+// every transaction in the same window gets the same key. The transaction
+// timestamp is used rather than the local clock, so that all endorsing peers
+// reach the same result. An empty key is returned if the timestamp is not set.
+func TimestampWindow(d time.Duration) func(stub shim.ChaincodeStubInterface) string {
+	return func(stub shim.ChaincodeStubInterface) string {
+		now, err := DeterministicNow(stub)
+		if err != nil {
+			return ""
+		}
+
+		return now.Truncate(d).Format(time.RFC3339)
+	}
+}
+
+// RateLimitPerIdentity creates a middleware that counts the transactions of
+// each creator in a window, and rejects the transaction with a 429 error once
+// the creator has made more than max transactions in the window. The window is
+// the key returned by windowKeyFn, such as TimestampWindow(time.Hour), and the
+// counters are stored on the ledger under composite keys of the creator's
+// GetCreatorIDHash and the window. Rejected and failed transactions are not
+// committed, so they don't count towards the limit.
+//
+// Every transaction reads and writes the counter of its creator, so concurrent
+// transactions by the same creator in the same block fail MVCC validation, in
+// the same way as NextSequence. Only use it where each creator submits
+// transactions one at a time, or can retry them.
+func RateLimitPerIdentity(windowKeyFn func(stub shim.ChaincodeStubInterface) string, max int) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		idHash, err := GetCreatorIDHash(stub)
+		if err != nil {
+			err = fmt.Errorf("error getting creator identity: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusForbidden, err.Error())
+		}
+
+		window := windowKeyFn(stub)
+		if window == "" {
+			err := "error getting rate limit window: window key is empty"
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err)
+		}
+
+		key, err := stub.CreateCompositeKey(rateLimitObjectType, []string{idHash, window})
+		if err != nil {
+			err = fmt.Errorf("error creating rate limit key: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err.Error())
+		}
+
+		// increment the creator's counter for the window
+		n, err := NextSequence(stub, key)
+		if err != nil {
+			err = fmt.Errorf("error incrementing rate limit counter: %s", err.Error())
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err.Error())
+		}
+		if n > uint64(max) {
+			err := fmt.Sprintf("rate limit exceeded, at most %d transactions are allowed in window %s", max, window)
+			Logger.Error(err)
+			return Error(http.StatusTooManyRequests, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
@@ -0,0 +1,59 @@
+package invoke
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestTimestampWindow(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	txTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: txTime.Unix()}
+
+	eq(t, "TimestampWindow(time.Hour)", "2020-01-02T03:00:00Z", TimestampWindow(time.Hour)(stub))
+	eq(t, "TimestampWindow(time.Minute)", "2020-01-02T03:04:00Z", TimestampWindow(time.Minute)(stub))
+
+	stub.TxTimestamp = nil
+	eq(t, "TimestampWindow without a timestamp", "", TimestampWindow(time.Hour)(stub))
+}
+
+func TestRateLimitPerIdentity(t *testing.T) {
+	alice := newCreatorStub(newTestIdentity(t, "Org1MSP", "alice", nil))
+	bob := creatorStub{alice.MockStub, newTestIdentity(t, "Org1MSP", "bob", nil)}
+	window := "w1"
+	windowKeyFn := func(stub shim.ChaincodeStubInterface) string { return window }
+
+	mw := RateLimitPerIdentity(windowKeyFn, 2)
+	handler := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}
+	invoke := func(stub creatorStub, txID string) pb.Response {
+		stub.MockTransactionStart(txID)
+		defer stub.MockTransactionEnd(txID)
+		return mw(stub, nil, handler)
+	}
+
+	eq(t, "alice tx 1 status", int32(200), invoke(alice, "1").Status)
+	eq(t, "alice tx 2 status", int32(200), invoke(alice, "2").Status)
+	rsp := invoke(alice, "3")
+	eq(t, "alice tx 3 status", int32(429), rsp.Status)
+	eq(t, "alice tx 3 message", "rate limit exceeded, at most 2 transactions are allowed in window w1", rsp.Message)
+
+	// each identity has its own counter
+	eq(t, "bob tx 1 status", int32(200), invoke(bob, "4").Status)
+
+	// counters are reset in a new window
+	window = "w2"
+	eq(t, "alice tx 4 status", int32(200), invoke(alice, "5").Status)
+
+	window = ""
+	eq(t, "status with empty window", int32(500), invoke(alice, "6").Status)
+
+	noCreator := newCreatorStub(nil)
+	eq(t, "status without creator", int32(403), invoke(noCreator, "7").Status)
+}
@@ -19,74 +19,474 @@ package invoke
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
+// Logger is used for internal logging, unless a router has its own logger set
+// with SetLogger.
 var Logger = shim.NewLogger("invoke")
 
 // Router objects manage handlers and middleware for invoke calls.
 type Router struct {
+	// context maps transaction IDs to the context of that transaction. The
+	// shim runs each transaction in its own goroutine, so it is guarded by
+	// contextMu, which is a pointer so that copies of the router share it
 	context         map[string]map[string]interface{}
+	contextMu       *sync.RWMutex
 	invokeMap       map[string]Handler
+	meta            map[string]HandlerMeta
 	middlewareChain []Middleware
+	notFound        Handler
+	metrics         MetricsSink
+	logger          *shim.ChaincodeLogger
+	defaultVersion  string
+	beforeHooks     []func(stub shim.ChaincodeStubInterface, function string, args []string)
+	afterHooks      []func(stub shim.ChaincodeStubInterface, function string, rsp pb.Response)
 }
 
+// MetricsSink receives metrics about each invoke handled by a router.
+type MetricsSink interface {
+	// ObserveInvoke is called after each invoke with the name of the invoked
+	// function, the status of the response, and the time taken to produce it.
+	ObserveInvoke(function string, status int32, duration time.Duration)
+}
+
+// noopMetricsSink is the default MetricsSink, which discards all metrics.
+type noopMetricsSink struct{}
+
+func (noopMetricsSink) ObserveInvoke(string, int32, time.Duration) {}
+
 // NewRouter returns a new router with no handlers or middleware.
 func NewRouter() Router {
 	return Router{
 		context:         make(map[string]map[string]interface{}),
+		contextMu:       new(sync.RWMutex),
 		invokeMap:       make(map[string]Handler),
+		meta:            make(map[string]HandlerMeta),
 		middlewareChain: make([]Middleware, 0),
+		metrics:         noopMetricsSink{},
 	}
 }
 
-// Use adds the given middleware to a list of middleware used on all invoke calls.
+// Use adds the given middleware to the end of the list of middleware used on
+// all invoke calls. Global middleware runs in the order it is listed, before
+// (and so wrapping) any middleware specific to the handler.
 func (r *Router) Use(mws ...Middleware) {
 	r.middlewareChain = append(r.middlewareChain, mws...)
 }
 
+// UseFirst adds the given middleware to the start of the list of middleware used
+// on all invoke calls, so it runs before (and wraps) all other middleware, such
+// as a logging or Recover middleware. The middleware provided runs in the order
+// it is listed.
+func (r *Router) UseFirst(mws ...Middleware) {
+	chain := make([]Middleware, 0, len(mws)+len(r.middlewareChain))
+	chain = append(chain, mws...)
+	r.middlewareChain = append(chain, r.middlewareChain...)
+}
+
+// MiddlewareCount returns the number of global middleware used on all invoke calls.
+func (r *Router) MiddlewareCount() int {
+	return len(r.middlewareChain)
+}
+
 // RegisterHandler adds a new handler to the router, wrapped in any specific middleware provided.
+// Registering a handler under a function name which is already registered
+// overwrites the existing handler. RegisterHandler panics if h is nil.
 func (r *Router) RegisterHandler(functionName string, h Handler, mws ...Middleware) Handler {
-	// attach the middleware
-	r.invokeMap[functionName] = h.use(mws...)
+	// fail fast, rather than when the function is invoked
+	if h == nil {
+		err := fmt.Sprintf("cannot register nil handler for function %s", functionName)
+		r.log().Error(err)
+		panic(err)
+	}
+	// attach the middleware. The global middleware is attached in Invoke, so
+	// wraps this middleware and runs before it
+	r.invokeMap[functionName] = r.withHandlerName(functionName, r.markHandlerRan(h).use(mws...))
+	// metadata describes the handler it was registered with
+	delete(r.meta, functionName)
 	// return the handler with middleware attached
 	return r.invokeMap[functionName]
 }
 
-// Invoke calls the appropriate handler for this invoke call.
-func (r *Router) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
-	// create context
-	r.context[stub.GetTxID()] = make(map[string]interface{})
+// ReservedKeyPrefix is the prefix of context keys used by this package, such
+// as FunctionNameKey. Keys with this prefix must not be used for other values
+// in the context, except through SetReserved.
+const ReservedKeyPrefix = "_invoke."
+
+// SetReserved stores a value in the transaction's context under the reserved
+// key ReservedKeyPrefix + key, so that it can't collide with other keys.
+func (r *Router) SetReserved(stub shim.ChaincodeStubInterface, key string, value interface{}) {
+	r.GetContext(stub)[ReservedKeyPrefix+key] = value
+}
+
+// GetReserved gets the value stored in the transaction's context by SetReserved
+// under the reserved key ReservedKeyPrefix + key. ok is false if there is no
+// value for the key.
+func (r *Router) GetReserved(stub shim.ChaincodeStubInterface, key string) (value interface{}, ok bool) {
+	value, ok = r.GetContext(stub)[ReservedKeyPrefix+key]
+	return value, ok
+}
+
+// FunctionNameKey is the context key under which Invoke stores the name of the
+// invoked function, as a string.
+const FunctionNameKey = ReservedKeyPrefix + "functionName"
+
+// FunctionName gets the name of the invoked function from the transaction's
+// context, or an empty string if it is called outside of Invoke. It is the name
+// sent by the client, before aliases and default versions are resolved, so it
+// is the same as the name returned by stub.GetFunctionAndParameters.
+func FunctionName(r Router, stub shim.ChaincodeStubInterface) string {
+	function, _ := ContextValue[string](r, stub, FunctionNameKey)
+	return function
+}
+
+// ArgsKey is the context key under which Invoke stores the arguments of the
+// invoked function, as a []string.
+const ArgsKey = ReservedKeyPrefix + "args"
+
+// Args gets the arguments of the invoked function from the transaction's
+// context, or nil if it is called outside of Invoke. They are the same as the
+// arguments returned by stub.GetFunctionAndParameters, which middleware that
+// doesn't take a router, including several in this package, uses instead.
+// The slice is the same one passed to the global middleware, so modifying it
+// affects all middleware and handlers which run after. Middleware which
+// replaces the arguments, such as Gunzip, passes a new slice on, so it is not
+// reflected in Args.
+func Args(r Router, stub shim.ChaincodeStubInterface) []string {
+	args, _ := ContextValue[[]string](r, stub, ArgsKey)
+	return args
+}
+
+// handlerNameKey is the context key under which the router stores the name the
+// running handler is registered under, as a string.
+const handlerNameKey = ReservedKeyPrefix + "handlerName"
+
+// handlerName gets the name the running handler is registered under from the
+// transaction's context. It is set by invoke once the function is looked up,
+// so it is available to global middleware, and by each registered handler
+// while it runs, so a handler called directly by another handler sees its own
+// name. It is the registered name after aliases and default versions are
+// resolved, and empty for the not found handler.
+func handlerName(r Router, stub shim.ChaincodeStubInterface) string {
+	name, _ := ContextValue[string](r, stub, handlerNameKey)
+	return name
+}
+
+// withHandlerName wraps the handler so that the name it is registered under is
+// stored in the transaction's context while it runs, restoring the previous
+// name once it returns.
+func (r *Router) withHandlerName(functionName string, h Handler) Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctx := r.GetContext(stub)
+		if ctx == nil {
+			return h(stub, args)
+		}
+
+		previous, ok := ctx[handlerNameKey]
+		ctx[handlerNameKey] = functionName
+		defer func() {
+			if ok {
+				ctx[handlerNameKey] = previous
+			} else {
+				delete(ctx, handlerNameKey)
+			}
+		}()
+
+		return h(stub, args)
+	}
+}
+
+// handlerRanKey is the context key under which markHandlerRan records that the
+// handler was called.
+const handlerRanKey = ReservedKeyPrefix + "handlerRan"
+
+// markHandlerRan wraps the handler so that calling it is recorded in the
+// transaction's context, for middleware which only acts if the handler ran.
+func (r *Router) markHandlerRan(h Handler) Handler {
+	return func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if ctx := r.GetContext(stub); ctx != nil {
+			ctx[handlerRanKey] = true
+		}
+		return h(stub, args)
+	}
+}
+
+// RegisterCtxHandler registers a CtxHandler, which is passed a context.Context
+// carrying the transaction ID, creator common name and transaction timestamp.
+// These can be read with TxIDFromContext, CreatorCommonNameFromContext and
+// TxTimestampFromContext. Otherwise it behaves the same as RegisterHandler.
+func (r *Router) RegisterCtxHandler(functionName string, h CtxHandler, mws ...Middleware) Handler {
+	if h == nil {
+		return r.RegisterHandler(functionName, nil, mws...)
+	}
+	return r.RegisterHandler(functionName, h.handler(), mws...)
+}
+
+// Alias registers the handler registered under existingName, including its
+// middleware, under newName as well. This allows a function to be renamed while
+// keeping the old name working. An error is returned if no handler is
+// registered under existingName.
+func (r *Router) Alias(newName, existingName string) error {
+	h, ok := r.invokeMap[existingName]
+	if !ok {
+		err := fmt.Errorf("cannot alias %s to unregistered function %s", newName, existingName)
+		r.log().Error(err.Error())
+		return err
+	}
+
+	r.invokeMap[newName] = h
+	if meta, ok := r.meta[existingName]; ok {
+		r.meta[newName] = meta
+	} else {
+		delete(r.meta, newName)
+	}
+	return nil
+}
+
+// Unregister removes the handler registered under the given function name,
+// and returns whether a handler was registered.
+func (r *Router) Unregister(functionName string) bool {
+	if _, ok := r.invokeMap[functionName]; !ok {
+		return false
+	}
+
+	delete(r.invokeMap, functionName)
+	delete(r.meta, functionName)
+	return true
+}
+
+// HasHandler returns whether a handler is registered under the given function name.
+func (r *Router) HasHandler(functionName string) bool {
+	_, ok := r.invokeMap[functionName]
+	return ok
+}
+
+// Routes returns a sorted list of the function names registered on the router.
+func (r *Router) Routes() []string {
+	routes := make([]string, 0, len(r.invokeMap))
+	for functionName := range r.invokeMap {
+		routes = append(routes, functionName)
+	}
+	sort.Strings(routes)
 
-	// get arguments to invoke
+	return routes
+}
+
+// SetNotFoundHandler sets a fallback handler which is called when the invoked
+// function has not been registered. The fallback is run through the global
+// middleware chain, and can retrieve the name of the invoked function with
+// stub.GetFunctionAndParameters(). Setting it to nil restores the default
+// behaviour of returning a 400 error.
+func (r *Router) SetNotFoundHandler(h Handler) {
+	if h != nil {
+		h = r.markHandlerRan(h)
+	}
+	r.notFound = h
+}
+
+// Validate checks the router for misconfiguration, so that it can be reported
+// when the chaincode starts rather than when a function is invoked. It reports
+// nil global middleware, function names starting with ReservedKeyPrefix, and a
+// default version with no handlers registered. Nil handlers are reported when
+// they are registered, as RegisterHandler panics.
+func (r *Router) Validate() error {
+	var problems []string
+	for _, functionName := range r.Routes() {
+		if strings.HasPrefix(functionName, ReservedKeyPrefix) {
+			problems = append(problems, fmt.Sprintf("function %s uses the reserved prefix %s", functionName, ReservedKeyPrefix))
+		}
+	}
+
+	for i, mw := range r.middlewareChain {
+		if mw == nil {
+			problems = append(problems, fmt.Sprintf("global middleware %d is nil", i))
+		}
+	}
+
+	if r.defaultVersion != "" {
+		found := false
+		for functionName := range r.invokeMap {
+			if strings.HasPrefix(functionName, r.defaultVersion+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("default version %s has no handlers", r.defaultVersion))
+		}
+	}
+
+	if len(problems) > 0 {
+		err := fmt.Errorf("invalid router: %s", strings.Join(problems, "; "))
+		r.log().Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SetMetricsSink sets the sink which receives metrics about each invoke.
+// Setting it to nil discards metrics, which is the default.
+func (r *Router) SetMetricsSink(sink MetricsSink) {
+	if sink == nil {
+		sink = noopMetricsSink{}
+	}
+	r.metrics = sink
+}
+
+// OnBeforeInvoke adds a hook which is called at the start of each invoke with
+// the function name and arguments, before any middleware. Hooks run outside the
+// middleware chain and can't affect the response, so they suit observation
+// such as logging and metrics. They must not modify the arguments. Hooks run
+// in the order they were added.
+func (r *Router) OnBeforeInvoke(hook func(stub shim.ChaincodeStubInterface, function string, args []string)) {
+	r.beforeHooks = append(r.beforeHooks, hook)
+}
+
+// OnAfterInvoke adds a hook which is called at the end of each invoke with the
+// function name and the response, after all middleware. Like OnBeforeInvoke,
+// hooks run in the order they were added and can't affect the response.
+func (r *Router) OnAfterInvoke(hook func(stub shim.ChaincodeStubInterface, function string, rsp pb.Response)) {
+	r.afterHooks = append(r.afterHooks, hook)
+}
+
+// SetLogger sets the logger used by the router, and by middleware created with
+// the router, such as JSONParser, in place of the package Logger. Middleware
+// which doesn't take a router, such as Recover, AccessLog and RequireMSP,
+// always logs to the package Logger. Middleware holds a copy of the router, so
+// SetLogger must be called before creating middleware which takes the router.
+// Setting it to nil falls back to the package Logger.
+func (r *Router) SetLogger(l *shim.ChaincodeLogger) {
+	r.logger = l
+}
+
+// log returns the router's logger, or the package Logger if it is not set.
+func (r *Router) log() *shim.ChaincodeLogger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return Logger
+}
+
+// Invoke calls the appropriate handler for this invoke call. Middleware runs in
+// a fixed order, regardless of the order it was added to the router:
+//
+//  1. global middleware, in the order it is listed (see Use and UseFirst)
+//  2. route group middleware, in the order it is listed
+//  3. middleware passed to RegisterHandler, in the order it is listed
+//  4. the handler
+//
+// Each middleware wraps everything after it, so code after a call to next runs
+// in the reverse order.
+//
+// The transaction's context is removed once Invoke returns, even if the handler
+// panics, so any values needed after the invoke must be copied out of the
+// context by the handler.
+func (r *Router) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	// get arguments to invoke, and store them and the function name in the
+	// context, cleaning it up once the invoke is complete
+	txID := stub.GetTxID()
 	function, args := stub.GetFunctionAndParameters()
+	r.setContext(txID, map[string]interface{}{
+		FunctionNameKey: function,
+		ArgsKey:         args,
+	})
+	defer r.deleteContext(txID)
+
+	for _, hook := range r.beforeHooks {
+		hook(stub, function, args)
+	}
 
+	// execute the invoke, and report its metrics
+	start := time.Now()
+	rsp := r.invoke(stub, function, args)
+	r.metrics.ObserveInvoke(function, rsp.Status, time.Since(start))
+
+	for _, hook := range r.afterHooks {
+		hook(stub, function, rsp)
+	}
+
+	return rsp
+}
+
+// lookup returns the name under which the handler for the function is
+// registered, falling back to the default version of the function.
+func (r *Router) lookup(function string) (string, bool) {
+	if _, ok := r.invokeMap[function]; ok {
+		return function, true
+	}
+	if r.defaultVersion != "" {
+		if _, ok := r.invokeMap[r.defaultVersion+"/"+function]; ok {
+			return r.defaultVersion + "/" + function, true
+		}
+	}
+	return "", false
+}
+
+// invoke calls the handler for the function, wrapped in the global middleware chain.
+func (r *Router) invoke(stub shim.ChaincodeStubInterface, function string, args []string) pb.Response {
 	// get invoke handler from map
 	var fn Handler
-	var ok bool
-	if fn, ok = r.invokeMap[function]; !ok {
-		// if the function was not in the invoke map, return an error
-		err := fmt.Errorf("invalid invoke function \"%s\"", function)
-		Logger.Error(err.Error())
-		return Error(http.StatusBadRequest, err.Error())
+	registeredName, ok := r.lookup(function)
+	if ok {
+		fn = r.invokeMap[registeredName]
+	} else {
+		// if no function was given, the client is calling the chaincode
+		// incorrectly, so don't fall back to the not found handler
+		if function == "" {
+			err := "no invoke function specified"
+			r.log().Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// if the function was not in the invoke map and there is no
+		// fallback, return an error
+		if r.notFound == nil {
+			err := fmt.Errorf("invalid invoke function \"%s\"", function)
+			r.log().Error(err.Error())
+			return Error(http.StatusBadRequest, err.Error())
+		}
+		fn = r.notFound
 	}
 
+	// store the registered name for global middleware
+	r.GetContext(stub)[handlerNameKey] = registeredName
+
 	// attach the global middleware chain
 	fn = fn.use(r.middlewareChain...)
 
 	// execute invoke function
-	result := fn(stub, args)
-
-	// clean up context
-	delete(r.context, stub.GetTxID())
-
-	// return result
-	return result
+	return fn(stub, args)
 }
 
-// GetContext returns the context for the transaction
+// GetContext returns the context for the transaction. Each transaction has its
+// own context, keyed by transaction ID, which is created at the start of Invoke
+// and removed once Invoke completes, so values are never shared between
+// concurrent invokes. The returned map must only be used by the goroutine
+// running the transaction.
 func (r *Router) GetContext(stub shim.ChaincodeStubInterface) map[string]interface{} {
+	r.contextMu.RLock()
+	defer r.contextMu.RUnlock()
 	return r.context[stub.GetTxID()]
 }
+
+// setContext sets the context of the transaction.
+func (r *Router) setContext(txID string, ctx map[string]interface{}) {
+	r.contextMu.Lock()
+	defer r.contextMu.Unlock()
+	r.context[txID] = ctx
+}
+
+// deleteContext removes the context of the transaction.
+func (r *Router) deleteContext(txID string) {
+	r.contextMu.Lock()
+	defer r.contextMu.Unlock()
+	delete(r.context, txID)
+}
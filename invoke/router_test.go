@@ -3,7 +3,9 @@ package invoke
 import (
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -37,6 +39,22 @@ func TestRouterUse(t *testing.T) {
 	eq(t, "len(router.middlewareChain)", 2, len(router.middlewareChain))
 }
 
+func TestRouterUseFirst(t *testing.T) {
+	router := NewRouter()
+	key := "test"
+	router.Use(mwIntAppender(router, key, 3))
+	router.UseFirst(mwIntAppender(router, key, 1), mwIntAppender(router, key, 2))
+	eq(t, "router.MiddlewareCount()", 3, router.MiddlewareCount())
+
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	h := hIntAppender(router, key, 4).use(router.middlewareChain...)
+	h(stub, nil)
+
+	deepEq(t, "router.GetContext(stub)[key]", []int{1, 2, 3, 4}, router.GetContext(stub)[key])
+}
+
 func TestRegisterHandler(t *testing.T) {
 	router := NewRouter()
 	key := "test"
@@ -53,6 +71,117 @@ func TestRegisterHandler(t *testing.T) {
 	notNil(t, "h", h)
 }
 
+func TestAlias(t *testing.T) {
+	router := NewRouter()
+	calls := 0
+	router.RegisterHandler("transfer", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls++
+		return Success(200, nil)
+	}, mwIntAppender(router, "test", 1))
+
+	eq(t, "router.Alias(\"send\", \"transfer\")", nil, router.Alias("send", "transfer"))
+	deepEq(t, "transfer response", Success(200, nil), invokeRouter(&router, "1", "transfer"))
+	deepEq(t, "send response", Success(200, nil), invokeRouter(&router, "2", "send"))
+	eq(t, "handler calls", 2, calls)
+
+	err := router.Alias("move", "missing")
+	eq(t, "router.Alias(\"move\", \"missing\")", "cannot alias move to unregistered function missing", err.Error())
+	eq(t, "router.HasHandler(\"move\")", false, router.HasHandler("move"))
+}
+
+func TestRegisterNilHandler(t *testing.T) {
+	var tests = []struct {
+		name     string
+		register func(router *Router)
+		expected string
+	}{
+		{"RegisterHandler", func(router *Router) { router.RegisterHandler("nil", nil) }, "cannot register nil handler for function nil"},
+		{"RegisterCtxHandler", func(router *Router) { router.RegisterCtxHandler("nil", nil) }, "cannot register nil handler for function nil"},
+		{"RouteGroup.RegisterHandler", func(router *Router) { router.Group("group_").RegisterHandler("nil", nil) }, "cannot register nil handler for function group_nil"},
+	}
+
+	for _, v := range tests {
+		func() {
+			defer func() {
+				eq(t, v.name+" panic", v.expected, recover())
+			}()
+			router := NewRouter()
+			v.register(&router)
+		}()
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	router := NewRouter()
+	endpoint := "endpoint"
+	router.RegisterHandler(endpoint, hIntAppender(router, "test", 1))
+
+	eq(t, fmt.Sprintf("router.HasHandler(%s)", endpoint), true, router.HasHandler(endpoint))
+	eq(t, fmt.Sprintf("router.Unregister(%s)", endpoint), true, router.Unregister(endpoint))
+	eq(t, fmt.Sprintf("router.HasHandler(%s)", endpoint), false, router.HasHandler(endpoint))
+	eq(t, fmt.Sprintf("router.Unregister(%s)", endpoint), false, router.Unregister(endpoint))
+	eq(t, "len(router.invokeMap)", 0, len(router.invokeMap))
+}
+
+func TestRoutes(t *testing.T) {
+	router := NewRouter()
+	deepEq(t, "router.Routes()", []string{}, router.Routes())
+
+	router.RegisterHandler("b", hIntAppender(router, "test", 1))
+	router.RegisterHandler("c", hIntAppender(router, "test", 1))
+	router.RegisterHandler("a", hIntAppender(router, "test", 1))
+	routes := router.Routes()
+	deepEq(t, "router.Routes()", []string{"a", "b", "c"}, routes)
+
+	// modifying the result must not affect the router
+	routes[0] = "z"
+	deepEq(t, "router.Routes()", []string{"a", "b", "c"}, router.Routes())
+}
+
+func TestGetContextIsolation(t *testing.T) {
+	router := NewRouter()
+	key := "test"
+	stub1 := shim.NewMockStub("test", new(testCC))
+	stub1.MockTransactionStart("1")
+	stub2 := shim.NewMockStub("test", new(testCC))
+	stub2.MockTransactionStart("2")
+	// create the transaction contexts, this is normally done in router.Invoke()
+	router.context[stub1.GetTxID()] = make(map[string]interface{})
+	router.context[stub2.GetTxID()] = make(map[string]interface{})
+
+	router.GetContext(stub1)[key] = 1
+	router.GetContext(stub2)[key] = 2
+
+	eq(t, "router.GetContext(stub1)[key]", 1, router.GetContext(stub1)[key])
+	eq(t, "router.GetContext(stub2)[key]", 2, router.GetContext(stub2)[key])
+}
+
+func TestInvokeConcurrent(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("endpoint", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		router.GetContext(stub)["test"] = args[0]
+		return Success(200, []byte(MustContextValue[string](router, stub, "test")))
+	})
+
+	// the shim runs each transaction in its own goroutine, run with -race to
+	// check access to the contexts is synchronized
+	var wg sync.WaitGroup
+	rsps := make([]pb.Response, 20)
+	for i := range rsps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsps[i] = invokeRouter(&router, fmt.Sprint(i), "endpoint", fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, rsp := range rsps {
+		deepEq(t, fmt.Sprintf("response %d", i), Success(200, []byte(fmt.Sprint(i))), rsp)
+	}
+	eq(t, "len(router.context)", 0, len(router.context))
+}
+
 var invokeTests = []struct {
 	endpoint    string
 	expectedRsp pb.Response
@@ -84,6 +213,253 @@ func TestInvoke(t *testing.T) {
 	}
 }
 
+func TestInvokeEmptyArgs(t *testing.T) {
+	router := NewRouter()
+	router.Use(func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		return next(stub, args)
+	})
+	router.RegisterHandler("endpoint", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	deepEq(t, "invoke response with no args", Error(400, "no invoke function specified"), invokeRouter(&router, "1"))
+	deepEq(t, "invoke response with empty function", Error(400, "no invoke function specified"), invokeRouter(&router, "2", ""))
+
+	// the not found handler isn't used when no function is given
+	router.SetNotFoundHandler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	deepEq(t, "invoke response with no args and a not found handler", Error(400, "no invoke function specified"), invokeRouter(&router, "3"))
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	recorder := func(name string) Middleware {
+		return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+			calls = append(calls, name+" before")
+			rsp := next(stub, args)
+			calls = append(calls, name+" after")
+			return rsp
+		}
+	}
+
+	router := NewRouter()
+	group := router.Group("group_", recorder("group"))
+	group.RegisterHandler("test", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls = append(calls, "handler")
+		return Success(200, nil)
+	}, recorder("local 1"), recorder("local 2"))
+	// global middleware added after registering the handler still runs first
+	router.Use(recorder("global 2"))
+	router.UseFirst(recorder("global 1"))
+
+	invokeRouter(&router, "123", "group_test")
+
+	deepEq(t, "middleware calls", []string{
+		"global 1 before",
+		"global 2 before",
+		"group before",
+		"local 1 before",
+		"local 2 before",
+		"handler",
+		"local 2 after",
+		"local 1 after",
+		"group after",
+		"global 2 after",
+		"global 1 after",
+	}, calls)
+}
+
+func TestFunctionName(t *testing.T) {
+	router := NewRouter()
+	var function string
+	router.Use(func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		function = FunctionName(router, stub)
+		return next(stub, args)
+	})
+	router.RegisterHandler("test", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	invokeRouter(&router, "123", "test", "arg")
+	eq(t, "FunctionName(router, stub)", "test", function)
+}
+
+func TestArgs(t *testing.T) {
+	router := NewRouter()
+	var ctxArgs, handlerArgs []string
+	router.RegisterHandler("test", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		ctxArgs = Args(router, stub)
+		handlerArgs = args
+		return Success(200, nil)
+	})
+
+	invokeRouter(&router, "123", "test", "a", "b")
+	deepEq(t, "Args(router, stub)", []string{"a", "b"}, ctxArgs)
+	deepEq(t, "Args(router, stub) matches handler args", handlerArgs, ctxArgs)
+}
+
+func TestInvokeHooks(t *testing.T) {
+	router := NewRouter()
+	var calls []string
+	router.OnBeforeInvoke(func(stub shim.ChaincodeStubInterface, function string, args []string) {
+		calls = append(calls, fmt.Sprintf("before 1 %s %v", function, args))
+	})
+	router.OnBeforeInvoke(func(stub shim.ChaincodeStubInterface, function string, args []string) {
+		calls = append(calls, "before 2")
+	})
+	router.OnAfterInvoke(func(stub shim.ChaincodeStubInterface, function string, rsp pb.Response) {
+		calls = append(calls, fmt.Sprintf("after %s %d", function, rsp.Status))
+	})
+	router.Use(func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		calls = append(calls, "middleware")
+		return next(stub, args)
+	})
+	router.RegisterHandler("test", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		calls = append(calls, "handler")
+		return Success(201, nil)
+	})
+
+	deepEq(t, "response", Success(201, nil), invokeRouter(&router, "123", "test", "a"))
+	deepEq(t, "calls", []string{"before 1 test [a]", "before 2", "middleware", "handler", "after test 201"}, calls)
+}
+
+func TestReserved(t *testing.T) {
+	router := NewRouter()
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	// create the transaction context, this is normally done in router.Invoke()
+	router.context[stub.GetTxID()] = make(map[string]interface{})
+	router.GetContext(stub)["now"] = "user value"
+
+	router.SetReserved(stub, "now", "reserved value")
+	value, ok := router.GetReserved(stub, "now")
+	eq(t, "router.GetReserved(stub, \"now\")", "reserved value", value)
+	eq(t, "router.GetReserved(stub, \"now\") ok", true, ok)
+	eq(t, "router.GetContext(stub)[\"now\"]", "user value", router.GetContext(stub)["now"])
+	eq(t, "router.GetContext(stub)[ReservedKeyPrefix+\"now\"]", "reserved value", router.GetContext(stub)[ReservedKeyPrefix+"now"])
+
+	_, ok = router.GetReserved(stub, "missing")
+	eq(t, "router.GetReserved(stub, \"missing\") ok", false, ok)
+}
+
+func TestValidate(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("ok", hIntAppender(router, "test", 1))
+	router.Version("v1").RegisterHandler("ok", hIntAppender(router, "test", 1))
+	router.DefaultVersion("v1")
+	eq(t, "router.Validate() for valid router", nil, router.Validate())
+
+	router.RegisterHandler(ReservedKeyPrefix+"reserved", hIntAppender(router, "test", 1))
+	router.Use(nil)
+	router.DefaultVersion("v2")
+
+	err := router.Validate()
+	eq(t, "router.Validate() for invalid router", "invalid router: "+
+		"function _invoke.reserved uses the reserved prefix _invoke.; "+
+		"global middleware 0 is nil; "+
+		"default version v2 has no handlers", err.Error())
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	router := NewRouter()
+	key := "test"
+	router.Use(mwIntAppender(router, key, 1))
+	router.SetNotFoundHandler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		function, _ := stub.GetFunctionAndParameters()
+		// check the global middleware was run before the fallback
+		deepEq(t, "router.GetContext(stub)[key]", []int{1}, router.GetContext(stub)[key])
+		return Error(404, fmt.Sprintf("no such function %s", function))
+	})
+
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.MockInvoke("text", [][]byte{[]byte("nothing")})
+	rsp := router.Invoke(stub)
+	deepEq(t, "invoke response", Error(404, "no such function nothing"), rsp)
+}
+
+type testMetricsSink struct {
+	functions []string
+	statuses  []int32
+}
+
+func (s *testMetricsSink) ObserveInvoke(function string, status int32, duration time.Duration) {
+	s.functions = append(s.functions, function)
+	s.statuses = append(s.statuses, status)
+}
+
+func TestSetMetricsSink(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("ok", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+
+	sink := new(testMetricsSink)
+	router.SetMetricsSink(sink)
+	invokeRouter(&router, "1", "ok")
+	invokeRouter(&router, "2", "missing")
+
+	deepEq(t, "sink.functions", []string{"ok", "missing"}, sink.functions)
+	deepEq(t, "sink.statuses", []int32{200, 400}, sink.statuses)
+
+	// setting a nil sink falls back to discarding metrics
+	router.SetMetricsSink(nil)
+	eq(t, "invoke with nil sink status", int32(200), invokeRouter(&router, "3", "ok").Status)
+}
+
+func TestSetLogger(t *testing.T) {
+	router := NewRouter()
+	eq(t, "router.log() default", Logger, router.log())
+
+	logger := shim.NewLogger("test")
+	router.SetLogger(logger)
+	eq(t, "router.log() after SetLogger", logger, router.log())
+
+	router.SetLogger(nil)
+	eq(t, "router.log() after SetLogger(nil)", Logger, router.log())
+}
+
+func TestInvokeContextCleanup(t *testing.T) {
+	router := NewRouter()
+	router.RegisterHandler("endpoint", hIntAppender(router, "test", 1))
+	router.RegisterHandler("panic", func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		panic("handler panicked")
+	})
+
+	for i := 0; i < 100; i++ {
+		invokeRouter(&router, fmt.Sprintf("endpoint%d", i), "endpoint")
+		invokeRouter(&router, fmt.Sprintf("nothing%d", i), "nothing")
+	}
+	eq(t, "len(router.context)", 0, len(router.context))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected handler to panic")
+			}
+		}()
+		invokeRouter(&router, "panic", "panic")
+	}()
+	eq(t, "len(router.context)", 0, len(router.context))
+}
+
+// invokeRouter invokes the router with a mock stub for the given transaction
+// ID, using the given function name and args.
+func invokeRouter(router *Router, txID string, args ...string) pb.Response {
+	byteArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		byteArgs[i] = []byte(arg)
+	}
+
+	stub := shim.NewMockStub("test", new(testCC))
+	// this is only needed to set the args, which is the only part the router needs
+	stub.MockInvoke(txID, byteArgs)
+	// MockInvoke clears the transaction ID, so start the transaction again
+	stub.MockTransactionStart(txID)
+	return router.Invoke(stub)
+}
+
 func notNil(t *testing.T, name string, val interface{}) {
 	if val == nil || reflect.ValueOf(val).IsNil() {
 		t.Errorf("%s was unexpectedly nil", name)
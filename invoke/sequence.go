@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// NextSequence increments the counter stored as json under key, and returns the
+// new value. A counter which does not exist starts at 0, so the first value
+// returned is 1. Fabric does not return writes made earlier in the same
+// transaction, so NextSequence must only be called once per counter in each
+// transaction, or it will return the same value each time.
+//
+// The counter is read and written in the same transaction, so it is in both the
+// read set and the write set. If two transactions increment the same counter
+// in the same block, the second fails MVCC validation rather than reusing the
+// value, so each value is only committed once, but busy counters cause failed
+// transactions which the client must retry.
+func NextSequence(stub shim.ChaincodeStubInterface, key string) (uint64, error) {
+	n, err := PeekSequence(stub, key)
+	if err != nil {
+		return 0, err
+	}
+
+	n++
+	if _, err = PutJSON(stub, key, n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// PeekSequence gets the current value of the counter stored as json under key,
+// without incrementing it. A counter which does not exist has the value 0.
+// Calling PeekSequence after NextSequence in the same transaction returns the
+// previous value.
+func PeekSequence(stub shim.ChaincodeStubInterface, key string) (uint64, error) {
+	var n uint64
+	if err := GetJSONOrDefault(stub, key, &n, 0); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,29 @@
+package invoke
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestNextSequence(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+
+	n, err := PeekSequence(stub, "seq")
+	eq(t, "PeekSequence(stub, \"seq\") error", nil, err)
+	eq(t, "PeekSequence(stub, \"seq\") before first NextSequence", uint64(0), n)
+
+	for i := uint64(1); i <= 3; i++ {
+		n, err = NextSequence(stub, "seq")
+		eq(t, "NextSequence(stub, \"seq\") error", nil, err)
+		eq(t, "NextSequence(stub, \"seq\")", i, n)
+	}
+
+	n, _ = PeekSequence(stub, "seq")
+	eq(t, "PeekSequence(stub, \"seq\")", uint64(3), n)
+
+	stub.PutState("invalid", []byte("x"))
+	_, err = NextSequence(stub, "invalid")
+	notNil(t, "NextSequence(stub, \"invalid\") error", err)
+}
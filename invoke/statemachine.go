@@ -0,0 +1,76 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ErrInvalidTransition is wrapped by the errors returned by
+// StateMachine.CheckTransition, so it can be checked for with errors.Is.
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// StateMachine maps each state to the states which it can transition to, such
+// as the lifecycle of an asset. States with no outgoing transitions, such as a
+// final state, don't need to be listed.
+type StateMachine map[string][]string
+
+// CheckTransition returns nil if the state machine allows the transition from
+// the state from to the state to. Otherwise it returns an InvokeError with a
+// 409 status, wrapping ErrInvalidTransition.
+func (sm StateMachine) CheckTransition(from, to string) error {
+	for _, allowed := range sm[from] {
+		if to == allowed {
+			return nil
+		}
+	}
+
+	return NewInvokeError(http.StatusConflict, fmt.Sprintf("%s from %s to %s", ErrInvalidTransition.Error(), from, to), ErrInvalidTransition)
+}
+
+// GuardTransition creates a middleware which rejects the transaction unless the
+// state machine allows the transition from the current state, loaded with
+// currentStateFn, to the state in the specified argument position. Illegal
+// transitions are rejected with a 409. Errors from currentStateFn are returned
+// with ErrorFrom, so a missing record, reported with an error wrapping
+// ErrKeyNotFound as GetJSON does, is rejected with a 404.
+func GuardTransition(currentStateFn func(stub shim.ChaincodeStubInterface, args []string) (string, error), toArgIndex int, sm StateMachine) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if toArgIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", toArgIndex)
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error checking transition: %s", err))
+		}
+
+		from, err := currentStateFn(stub, args)
+		if err != nil {
+			Logger.Error(err)
+			return ErrorFrom(err)
+		}
+
+		if err = sm.CheckTransition(from, args[toArgIndex]); err != nil {
+			Logger.Error(err)
+			return ErrorFrom(err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
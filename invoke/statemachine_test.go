@@ -0,0 +1,65 @@
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var lifecycle = StateMachine{
+	"created": {"active", "cancelled"},
+	"active":  {"closed"},
+}
+
+var checkTransitionTests = []struct {
+	from, to string
+	valid    bool
+}{
+	{"created", "active", true},
+	{"created", "cancelled", true},
+	{"active", "closed", true},
+	{"created", "closed", false},
+	{"closed", "active", false},
+	{"unknown", "active", false},
+}
+
+func TestCheckTransition(t *testing.T) {
+	for _, v := range checkTransitionTests {
+		err := lifecycle.CheckTransition(v.from, v.to)
+		desc := fmt.Sprintf("lifecycle.CheckTransition(%q, %q)", v.from, v.to)
+		if v.valid {
+			eq(t, desc, nil, err)
+		} else {
+			eq(t, desc+" is ErrInvalidTransition", true, errors.Is(err, ErrInvalidTransition))
+		}
+	}
+}
+
+func TestGuardTransition(t *testing.T) {
+	type asset struct {
+		Status string `json:"status"`
+	}
+	currentState := func(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+		var a asset
+		if err := GetJSON(stub, args[0], &a); err != nil {
+			return "", err
+		}
+		return a.Status, nil
+	}
+
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	PutJSON(stub, "a", asset{"created"})
+
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	}).use(GuardTransition(currentState, 1, lifecycle))
+
+	deepEq(t, "legal transition response", Success(200, nil), h(stub, []string{"a", "active"}))
+	deepEq(t, "illegal transition response", Error(409, "invalid state transition from created to closed"), h(stub, []string{"a", "closed"}))
+	eq(t, "missing record response status", int32(404), h(stub, []string{"b", "active"}).Status)
+	eq(t, "missing argument response status", int32(500), h(stub, []string{"a"}).Status)
+}
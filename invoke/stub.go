@@ -0,0 +1,365 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ErrReadOnly is returned by a ReadOnlyStub when a handler tries to write.
+var ErrReadOnly = errors.New("write attempted by read-only handler")
+
+// ReadOnlyStub wraps a stub, returning an error wrapping ErrReadOnly from every
+// method which writes state, private data, endorsement policies or events.
+type ReadOnlyStub struct {
+	shim.ChaincodeStubInterface
+}
+
+// readOnlyError logs and returns an error for a write to the read-only stub.
+func readOnlyError(method, key string) error {
+	err := fmt.Errorf("%w: %s(%s)", ErrReadOnly, method, key)
+	Logger.Error(err.Error())
+	return err
+}
+
+func (ReadOnlyStub) PutState(key string, value []byte) error {
+	return readOnlyError("PutState", key)
+}
+
+func (ReadOnlyStub) DelState(key string) error {
+	return readOnlyError("DelState", key)
+}
+
+func (ReadOnlyStub) SetStateValidationParameter(key string, ep []byte) error {
+	return readOnlyError("SetStateValidationParameter", key)
+}
+
+func (ReadOnlyStub) PutPrivateData(collection string, key string, value []byte) error {
+	return readOnlyError("PutPrivateData", key)
+}
+
+func (ReadOnlyStub) DelPrivateData(collection, key string) error {
+	return readOnlyError("DelPrivateData", key)
+}
+
+func (ReadOnlyStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return readOnlyError("SetPrivateDataValidationParameter", key)
+}
+
+func (ReadOnlyStub) SetEvent(name string, payload []byte) error {
+	return readOnlyError("SetEvent", name)
+}
+
+// ReadOnly creates a middleware that passes a ReadOnlyStub to subsequent
+// middleware and the handler, so that query handlers can't change state by
+// mistake. Writes return an error wrapping ErrReadOnly.
+func ReadOnly() Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// call next handler with the read-only stub
+		return next(ReadOnlyStub{stub}, args)
+	}
+}
+
+// bufferedStub wraps a stub, holding back every write until flush is called,
+// so the writes can be discarded instead. Fabric does not return writes made
+// earlier in the transaction from GetState, so buffering them does not change
+// what is read.
+type bufferedStub struct {
+	shim.ChaincodeStubInterface
+	writes []func() error
+}
+
+// flush passes the buffered writes on to the wrapped stub, in the order they
+// were made, stopping at the first error.
+func (s *bufferedStub) flush() error {
+	for _, write := range s.writes {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	s.writes = nil
+	return nil
+}
+
+func (s *bufferedStub) buffer(write func() error) error {
+	s.writes = append(s.writes, write)
+	return nil
+}
+
+func (s *bufferedStub) PutState(key string, value []byte) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.PutState(key, value) })
+}
+
+func (s *bufferedStub) DelState(key string) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.DelState(key) })
+}
+
+func (s *bufferedStub) SetStateValidationParameter(key string, ep []byte) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.SetStateValidationParameter(key, ep) })
+}
+
+func (s *bufferedStub) PutPrivateData(collection string, key string, value []byte) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.PutPrivateData(collection, key, value) })
+}
+
+func (s *bufferedStub) DelPrivateData(collection, key string) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.DelPrivateData(collection, key) })
+}
+
+func (s *bufferedStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.SetPrivateDataValidationParameter(collection, key, ep) })
+}
+
+func (s *bufferedStub) SetEvent(name string, payload []byte) error {
+	return s.buffer(func() error { return s.ChaincodeStubInterface.SetEvent(name, payload) })
+}
+
+// StateAccess is a single call recorded by a RecordingStub. Op is the name of
+// the method called, Collection is the private data collection for methods
+// which access private data, and Value is the value written by PutState or
+// PutPrivateData. Each key returned by the iterator of a query is recorded
+// as a separate access, with Op set to the name of the query method.
+type StateAccess struct {
+	Op         string
+	Collection string
+	Key        string
+	Value      []byte
+}
+
+// isWrite returns whether the access wrote or deleted a key.
+func (a StateAccess) isWrite() bool {
+	switch a.Op {
+	case "PutState", "DelState", "PutPrivateData", "DelPrivateData":
+		return true
+	}
+	return false
+}
+
+// RecordingStub wraps a stub, recording each call which reads or writes state
+// or private data in order before passing it on to the wrapped stub, along
+// with each key returned by the iterators of queries. It is intended for
+// asserting which keys a handler read and wrote in tests.
+type RecordingStub struct {
+	shim.ChaincodeStubInterface
+	accesses []StateAccess
+}
+
+// NewRecordingStub returns a RecordingStub which wraps the given stub.
+func NewRecordingStub(stub shim.ChaincodeStubInterface) *RecordingStub {
+	return &RecordingStub{ChaincodeStubInterface: stub}
+}
+
+func (s *RecordingStub) record(a StateAccess) {
+	s.accesses = append(s.accesses, a)
+}
+
+// recordQuery wraps an iterator returned by the query method op, so that each
+// key it returns is recorded.
+func (s *RecordingStub) recordQuery(op, collection string, it shim.StateQueryIteratorInterface, err error) (shim.StateQueryIteratorInterface, error) {
+	if err != nil {
+		return nil, err
+	}
+	return recordingIterator{it, s, op, collection}, nil
+}
+
+func (s *RecordingStub) GetState(key string) ([]byte, error) {
+	s.record(StateAccess{Op: "GetState", Key: key})
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+func (s *RecordingStub) PutState(key string, value []byte) error {
+	s.record(StateAccess{Op: "PutState", Key: key, Value: value})
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+func (s *RecordingStub) DelState(key string) error {
+	s.record(StateAccess{Op: "DelState", Key: key})
+	return s.ChaincodeStubInterface.DelState(key)
+}
+
+func (s *RecordingStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetStateByRange(startKey, endKey)
+	return s.recordQuery("GetStateByRange", "", it, err)
+}
+
+func (s *RecordingStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, metadata, err := s.ChaincodeStubInterface.GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
+	it, err = s.recordQuery("GetStateByRangeWithPagination", "", it, err)
+	return it, metadata, err
+}
+
+func (s *RecordingStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetStateByPartialCompositeKey(objectType, keys)
+	return s.recordQuery("GetStateByPartialCompositeKey", "", it, err)
+}
+
+func (s *RecordingStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, metadata, err := s.ChaincodeStubInterface.GetStateByPartialCompositeKeyWithPagination(objectType, keys, pageSize, bookmark)
+	it, err = s.recordQuery("GetStateByPartialCompositeKeyWithPagination", "", it, err)
+	return it, metadata, err
+}
+
+func (s *RecordingStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetQueryResult(query)
+	return s.recordQuery("GetQueryResult", "", it, err)
+}
+
+func (s *RecordingStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, metadata, err := s.ChaincodeStubInterface.GetQueryResultWithPagination(query, pageSize, bookmark)
+	it, err = s.recordQuery("GetQueryResultWithPagination", "", it, err)
+	return it, metadata, err
+}
+
+func (s *RecordingStub) GetPrivateData(collection, key string) ([]byte, error) {
+	s.record(StateAccess{Op: "GetPrivateData", Collection: collection, Key: key})
+	return s.ChaincodeStubInterface.GetPrivateData(collection, key)
+}
+
+func (s *RecordingStub) PutPrivateData(collection string, key string, value []byte) error {
+	s.record(StateAccess{Op: "PutPrivateData", Collection: collection, Key: key, Value: value})
+	return s.ChaincodeStubInterface.PutPrivateData(collection, key, value)
+}
+
+func (s *RecordingStub) DelPrivateData(collection, key string) error {
+	s.record(StateAccess{Op: "DelPrivateData", Collection: collection, Key: key})
+	return s.ChaincodeStubInterface.DelPrivateData(collection, key)
+}
+
+func (s *RecordingStub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetPrivateDataByRange(collection, startKey, endKey)
+	return s.recordQuery("GetPrivateDataByRange", collection, it, err)
+}
+
+func (s *RecordingStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetPrivateDataByPartialCompositeKey(collection, objectType, keys)
+	return s.recordQuery("GetPrivateDataByPartialCompositeKey", collection, it, err)
+}
+
+func (s *RecordingStub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.ChaincodeStubInterface.GetPrivateDataQueryResult(collection, query)
+	return s.recordQuery("GetPrivateDataQueryResult", collection, it, err)
+}
+
+// recordingIterator wraps an iterator returned by a RecordingStub, recording
+// each key it returns as an access by the query method op.
+type recordingIterator struct {
+	shim.StateQueryIteratorInterface
+	stub       *RecordingStub
+	op         string
+	collection string
+}
+
+func (it recordingIterator) Next() (*queryresult.KV, error) {
+	kv, err := it.StateQueryIteratorInterface.Next()
+	if err == nil && kv != nil {
+		it.stub.record(StateAccess{Op: it.op, Collection: it.collection, Key: kv.Key})
+	}
+	return kv, err
+}
+
+// Accesses returns every recorded call, in the order they were made.
+func (s *RecordingStub) Accesses() []StateAccess {
+	return append([]StateAccess(nil), s.accesses...)
+}
+
+// Reads returns the keys of public state which were passed to GetState or
+// returned by a query, in the order they were read.
+func (s *RecordingStub) Reads() []string {
+	var keys []string
+	for _, a := range s.accesses {
+		if !a.isWrite() && a.Collection == "" {
+			keys = append(keys, a.Key)
+		}
+	}
+	return keys
+}
+
+// Writes returns the recorded calls which wrote or deleted state or private
+// data, in the order they were made.
+func (s *RecordingStub) Writes() []StateAccess {
+	var writes []StateAccess
+	for _, a := range s.accesses {
+		if a.isWrite() {
+			writes = append(writes, a)
+		}
+	}
+	return writes
+}
+
+// ReadBeforeWriteChecks enables the RequireReadBeforeWrite middleware. It is
+// false by default, so the middleware has no overhead in production, and is
+// intended to be enabled in tests and development.
+var ReadBeforeWriteChecks = false
+
+// RequireReadBeforeWrite creates a middleware which, when ReadBeforeWriteChecks
+// is enabled, records the state accessed by the handler with a RecordingStub,
+// and returns a 500 error if the handler wrote or deleted a key which it
+// hadn't read earlier in the transaction. A blind write doesn't put the key in
+// the transaction's read set, so Fabric's MVCC validation can't detect that a
+// concurrent transaction changed it, and that update is lost. Responses with
+// an error status are returned unchanged.
+//
+// Keys read with GetState, or returned by the iterators of range, partial
+// composite key and rich queries, count as read. Private data is checked in
+// the same way, and reported as collection/key. Fabric does not re-run rich
+// queries when it validates the transaction, so a key only read by a rich
+// query is not reported, although concurrent changes to it are still lost.
+func RequireReadBeforeWrite() Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		if !ReadBeforeWriteChecks {
+			// call next handler
+			return next(stub, args)
+		}
+
+		// call next handler with a stub which records its accesses
+		recorder := NewRecordingStub(stub)
+		rsp := next(recorder, args)
+		if rsp.Status >= 400 {
+			return rsp
+		}
+
+		// find writes to keys which had not been read yet, listing each once
+		read := make(map[string]bool)
+		reported := make(map[string]bool)
+		var blind []string
+		for _, a := range recorder.Accesses() {
+			key := a.Key
+			if a.Collection != "" {
+				key = a.Collection + "/" + a.Key
+			}
+
+			if !a.isWrite() {
+				read[key] = true
+			} else if !read[key] && !reported[key] {
+				reported[key] = true
+				blind = append(blind, key)
+			}
+		}
+
+		if len(blind) > 0 {
+			err := fmt.Sprintf("handler wrote keys without reading them first: %s", strings.Join(blind, ", "))
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, err)
+		}
+
+		return rsp
+	}
+}
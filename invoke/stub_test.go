@@ -0,0 +1,173 @@
+package invoke
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestReadOnly(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("key", []byte("value"))
+
+	var errs []error
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		value, err := stub.GetState("key")
+		eq(t, "GetState(\"key\") error", nil, err)
+		eq(t, "GetState(\"key\")", "value", string(value))
+
+		errs = append(errs,
+			stub.PutState("key", nil),
+			stub.DelState("key"),
+			stub.SetStateValidationParameter("key", nil),
+			stub.PutPrivateData("collection", "key", nil),
+			stub.DelPrivateData("collection", "key"),
+			stub.SetPrivateDataValidationParameter("collection", "key", nil),
+			stub.SetEvent("event", nil),
+		)
+		return Success(200, nil)
+	}).use(ReadOnly())
+
+	deepEq(t, "read-only handler response", Success(200, nil), h(stub, nil))
+	for i, err := range errs {
+		eq(t, "errors.Is(write error, ErrReadOnly)", true, errors.Is(err, ErrReadOnly))
+		if i == 0 {
+			eq(t, "PutState error", "write attempted by read-only handler: PutState(key)", err.Error())
+		}
+	}
+
+	value, _ := stub.GetState("key")
+	eq(t, "state after read-only handler", "value", string(value))
+}
+
+func TestRecordingStub(t *testing.T) {
+	mock := shim.NewMockStub("test", new(testCC))
+	mock.MockTransactionStart("123")
+	stub := NewRecordingStub(mock)
+
+	stub.GetState("a")
+	stub.PutState("b", []byte("1"))
+	stub.GetState("b")
+	stub.DelState("a")
+
+	deepEq(t, "stub.Accesses()", []StateAccess{
+		{Op: "GetState", Key: "a"},
+		{Op: "PutState", Key: "b", Value: []byte("1")},
+		{Op: "GetState", Key: "b"},
+		{Op: "DelState", Key: "a"},
+	}, stub.Accesses())
+	deepEq(t, "stub.Reads()", []string{"a", "b"}, stub.Reads())
+	deepEq(t, "stub.Writes()", []StateAccess{
+		{Op: "PutState", Key: "b", Value: []byte("1")},
+		{Op: "DelState", Key: "a"},
+	}, stub.Writes())
+
+	// calls are passed on to the wrapped stub
+	value, _ := mock.GetState("b")
+	eq(t, "mock.GetState(\"b\")", "1", string(value))
+}
+
+func TestRecordingStubQueries(t *testing.T) {
+	mock := newQueryStub()
+	mock.PutState("a", []byte("1"))
+	mock.PutState("b", []byte("2"))
+	stub := NewRecordingStub(mock)
+
+	it, _ := stub.GetStateByRange("a", "c")
+	for it.HasNext() {
+		it.Next()
+	}
+	it.Close()
+	stub.PutPrivateData("collection", "p", []byte("3"))
+	stub.GetPrivateData("collection", "p")
+
+	deepEq(t, "stub.Accesses()", []StateAccess{
+		{Op: "GetStateByRange", Key: "a"},
+		{Op: "GetStateByRange", Key: "b"},
+		{Op: "PutPrivateData", Collection: "collection", Key: "p", Value: []byte("3")},
+		{Op: "GetPrivateData", Collection: "collection", Key: "p"},
+	}, stub.Accesses())
+	deepEq(t, "stub.Reads()", []string{"a", "b"}, stub.Reads())
+	deepEq(t, "stub.Writes()", []StateAccess{
+		{Op: "PutPrivateData", Collection: "collection", Key: "p", Value: []byte("3")},
+	}, stub.Writes())
+}
+
+func TestRequireReadBeforeWrite(t *testing.T) {
+	stub := newQueryStub()
+
+	blind := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		stub.GetState("a")
+		stub.PutState("a", []byte("1"))
+		stub.PutState("b", []byte("1"))
+		stub.PutState("b", []byte("2"))
+		stub.DelState("c")
+		return shim.Success(nil)
+	}
+	failed := func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		stub.PutState("d", []byte("1"))
+		return shim.Error("failed")
+	}
+
+	// the checks are disabled by default
+	rsp := RequireReadBeforeWrite()(stub, nil, blind)
+	eq(t, "rsp.Status with checks disabled", int32(shim.OK), rsp.Status)
+
+	ReadBeforeWriteChecks = true
+	defer func() { ReadBeforeWriteChecks = false }()
+
+	rsp = RequireReadBeforeWrite()(stub, nil, blind)
+	eq(t, "rsp.Status with blind writes", int32(500), rsp.Status)
+	eq(t, "rsp.Message with blind writes", "handler wrote keys without reading them first: b, c", rsp.Message)
+
+	rsp = RequireReadBeforeWrite()(stub, nil, func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		stub.GetState("b")
+		stub.PutState("b", []byte("2"))
+		return shim.Success(nil)
+	})
+	eq(t, "rsp.Status with reads before writes", int32(shim.OK), rsp.Status)
+
+	// keys returned by queries are read
+	for name, query := range map[string]func(stub shim.ChaincodeStubInterface) (shim.StateQueryIteratorInterface, error){
+		"range": func(stub shim.ChaincodeStubInterface) (shim.StateQueryIteratorInterface, error) {
+			return stub.GetStateByRange("", "")
+		},
+		"partial composite": func(stub shim.ChaincodeStubInterface) (shim.StateQueryIteratorInterface, error) {
+			return stub.GetStateByPartialCompositeKey("asset", nil)
+		},
+		"rich": func(stub shim.ChaincodeStubInterface) (shim.StateQueryIteratorInterface, error) {
+			return stub.GetQueryResult("{}")
+		},
+	} {
+		key, _ := stub.CreateCompositeKey("asset", []string{"1"})
+		stub.PutState(key, []byte("1"))
+		rsp = RequireReadBeforeWrite()(stub, nil, func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			it, err := query(stub)
+			if err != nil {
+				return ErrorFrom(err)
+			}
+			defer it.Close()
+			for it.HasNext() {
+				kv, _ := it.Next()
+				stub.PutState(kv.Key, []byte("2"))
+			}
+			return shim.Success(nil)
+		})
+		deepEq(t, "rsp after "+name+" query", shim.Success(nil), rsp)
+	}
+
+	// private data is tracked separately from public state
+	rsp = RequireReadBeforeWrite()(stub, nil, func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		stub.GetState("p")
+		stub.PutPrivateData("collection", "p", []byte("1"))
+		return shim.Success(nil)
+	})
+	eq(t, "rsp.Message with blind private data write", "handler wrote keys without reading them first: collection/p", rsp.Message)
+
+	// error responses are returned unchanged
+	rsp = RequireReadBeforeWrite()(stub, nil, failed)
+	eq(t, "rsp.Message with error response", "failed", rsp.Message)
+}
@@ -15,9 +15,18 @@ package invoke
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -25,6 +34,11 @@ import (
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
+// ErrKeyNotFound is returned when a key which does not exist is read from the
+// ledger. It is wrapped with the name of the key, so it should be checked for
+// with errors.Is.
+var ErrKeyNotFound = errors.New("key not found")
+
 // Success is a helper function emulating the behaviour of ChaincodeStubInterface.Success,
 // but with a custom status parameter instead of the default 200
 func Success(status int32, payload []byte) pb.Response {
@@ -43,27 +57,250 @@ func Error(status int32, message string) pb.Response {
 	}
 }
 
+// SuccessWithContentType is similar to Success, but for payloads which are not
+// json, such as CSV or binary data. As pb.Response has no headers, the content
+// type is written as the first line of the payload, followed by a newline and
+// then the payload itself. Clients can separate the two with SplitContentType.
+// A content type containing a newline would corrupt the payload, so a 500
+// error is returned instead.
+func SuccessWithContentType(status int32, contentType string, payload []byte) pb.Response {
+	if strings.ContainsAny(contentType, "\r\n") {
+		err := fmt.Sprintf("content type %q must not contain a newline", contentType)
+		Logger.Error(err)
+		return Error(http.StatusInternalServerError, err)
+	}
+
+	envelope := make([]byte, 0, len(contentType)+1+len(payload))
+	envelope = append(envelope, contentType...)
+	envelope = append(envelope, '\n')
+	envelope = append(envelope, payload...)
+
+	return Success(status, envelope)
+}
+
+// SplitContentType separates a payload created by SuccessWithContentType into
+// its content type and the original payload. If the payload has no newline,
+// it is returned with an empty content type.
+func SplitContentType(payload []byte) (contentType string, body []byte) {
+	i := bytes.IndexByte(payload, '\n')
+	if i < 0 {
+		return "", payload
+	}
+	return string(payload[:i]), payload[i+1:]
+}
+
+// ErrorBody is the json payload of responses created by ErrorJSON.
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorJSON is similar to Error, but also sets the payload of the response to
+// an ErrorBody containing the code and message as json, for clients which only
+// read the payload. The code is free-form, so applications can define their own
+// error codes.
+func ErrorJSON(status int32, code, message string) pb.Response {
+	// marshalling a struct of strings cannot fail
+	payload, _ := json.Marshal(ErrorBody{Code: code, Message: message})
+
+	return pb.Response{
+		Status:  status,
+		Message: message,
+		Payload: payload,
+	}
+}
+
 // PutJSON marshals the given object to json and writes it to the ledger.
 func PutJSON(stub shim.ChaincodeStubInterface, key string, value interface{}) ([]byte, error) {
-	// serialise the record as json
-	var b []byte
-	var err error
-	if b, err = json.Marshal(value); err != nil {
+	return PutWithCodec(stub, JSONCodec, key, value)
+}
+
+// PutJSONComposite creates a composite key from the object type and attributes,
+// and writes the given object to the ledger under that key as json. The key is
+// returned along with the json encoded byte array.
+func PutJSONComposite(stub shim.ChaincodeStubInterface, objectType string, attributes []string, value interface{}) (string, []byte, error) {
+	key, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
 		Logger.Error(err.Error())
-		return nil, err
+		return "", nil, err
+	}
+
+	b, err := PutJSON(stub, key, value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, b, nil
+}
+
+// ErrInvalidCompositeKey is returned by SplitKeyJSON for a key which is not a
+// composite key.
+var ErrInvalidCompositeKey = errors.New("invalid composite key")
+
+// SplitKeyJSON splits a composite key, such as the key of a record returned by
+// the query functions, into its object type and attributes. The key may also
+// be given as a json string, exactly as it appears in their json results, with
+// the null characters escaped. An error wrapping ErrInvalidCompositeKey is
+// returned if the key does not start and end with a null character or does
+// not have an object type.
+func SplitKeyJSON(stub shim.ChaincodeStubInterface, compositeKey string) (objectType string, attrs []string, err error) {
+	key := compositeKey
+	if strings.HasPrefix(key, `"`) {
+		if err = json.Unmarshal([]byte(key), &key); err != nil {
+			err = fmt.Errorf("%w: %q: %s", ErrInvalidCompositeKey, compositeKey, err.Error())
+			Logger.Error(err.Error())
+			return "", nil, err
+		}
 	}
 
-	// write the record to the chain
-	if err = stub.PutState(key, b); err != nil {
+	if len(key) < 2 || key[0] != 0 || key[len(key)-1] != 0 {
+		err = fmt.Errorf("%w: %q", ErrInvalidCompositeKey, compositeKey)
 		Logger.Error(err.Error())
-		return nil, err
+		return "", nil, err
+	}
+
+	objectType, attrs, err = stub.SplitCompositeKey(key)
+	if err != nil {
+		err = fmt.Errorf("%w: %q: %s", ErrInvalidCompositeKey, compositeKey, err.Error())
+		Logger.Error(err.Error())
+		return "", nil, err
+	}
+	if objectType == "" {
+		err = fmt.Errorf("%w: %q has no object type", ErrInvalidCompositeKey, compositeKey)
+		Logger.Error(err.Error())
+		return "", nil, err
 	}
 
-	return b, nil
+	return objectType, attrs, nil
 }
 
 // GetJSON retrieves a value from the ledger and attempts to unmarshal it as json.
+// If the key does not exist, an error wrapping ErrKeyNotFound is returned.
 func GetJSON(stub shim.ChaincodeStubInterface, key string, valuePtr interface{}) error {
+	return GetWithCodec(stub, JSONCodec, key, valuePtr)
+}
+
+// PutJSONT marshals the given value to json and writes it to the ledger, like
+// PutJSON, then returns the value as it will be read back, by unmarshalling the
+// json written. The returned value reflects any changes made by marshalling,
+// such as fields omitted with omitempty or times truncated by custom
+// marshallers.
+func PutJSONT[T any](stub shim.ChaincodeStubInterface, key string, value T) (T, error) {
+	var stored T
+	b, err := PutJSON(stub, key, value)
+	if err != nil {
+		return stored, err
+	}
+	if err = json.Unmarshal(b, &stored); err != nil {
+		Logger.Errorf("error deserialising %s as json: %s", key, err.Error())
+		return stored, err
+	}
+
+	return stored, nil
+}
+
+// GetJSONT is the generic version of GetJSON, which returns the value rather
+// than populating a pointer. If the key does not exist, found is false and no
+// error is returned.
+func GetJSONT[T any](stub shim.ChaincodeStubInterface, key string) (value T, found bool, err error) {
+	err = GetJSON(stub, key, &value)
+	if errors.Is(err, ErrKeyNotFound) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+
+	return value, true, nil
+}
+
+// GetJSONOrDefault retrieves a value from the ledger like GetJSON, but if the
+// key does not exist, valuePtr is populated from defaultValue instead. The
+// default is copied by marshalling it to json and unmarshalling it into
+// valuePtr. Other errors, such as invalid json on the ledger, are returned.
+func GetJSONOrDefault(stub shim.ChaincodeStubInterface, key string, valuePtr interface{}, defaultValue interface{}) error {
+	err := GetJSON(stub, key, valuePtr)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	// copy the default value into valuePtr
+	b, err := json.Marshal(defaultValue)
+	if err != nil {
+		Logger.Error(err.Error())
+		return err
+	}
+	if err = json.Unmarshal(b, valuePtr); err != nil {
+		Logger.Errorf("error deserialising default value of %s as json: %s", key, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetMultiJSON retrieves the value of each key from the ledger and unmarshals
+// it as json into the pointer at the same position in valuePtrs. It stops at
+// the first key which fails, returning an error naming the key. If a key does
+// not exist, the error wraps ErrKeyNotFound.
+func GetMultiJSON(stub shim.ChaincodeStubInterface, keys []string, valuePtrs []interface{}) error {
+	if len(keys) != len(valuePtrs) {
+		err := fmt.Errorf("got %d keys but %d value pointers", len(keys), len(valuePtrs))
+		Logger.Error(err.Error())
+		return err
+	}
+
+	for i, key := range keys {
+		if err := GetJSON(stub, key, valuePtrs[i]); err != nil {
+			return multiGetError(key, err)
+		}
+	}
+
+	return nil
+}
+
+// GetMultiRawJSON retrieves the value of each key from the ledger, and returns
+// them mapped by key without unmarshalling them. Errors are handled in the same
+// way as GetMultiJSON.
+func GetMultiRawJSON(stub shim.ChaincodeStubInterface, keys []string) (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		var value json.RawMessage
+		if err := GetJSON(stub, key, &value); err != nil {
+			return nil, multiGetError(key, err)
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// multiGetError adds the key to an error from GetJSON, unless it is a not found
+// error, which already includes the key.
+func multiGetError(key string, err error) error {
+	if errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	return fmt.Errorf("error getting %s: %w", key, err)
+}
+
+// SoftDeleteField is the field set to true by SoftDeleteJSON to mark a record as deleted.
+var SoftDeleteField = "deleted"
+
+// DeleteJSON removes a value from the ledger.
+func DeleteJSON(stub shim.ChaincodeStubInterface, key string) error {
+	if err := stub.DelState(key); err != nil {
+		Logger.Errorf("error deleting state of %s from ledger: %s", key, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SoftDeleteJSON marks a json object on the ledger as deleted by setting its
+// SoftDeleteField to true, rather than removing it, so that the record remains
+// meaningful in history queries. If the key does not exist, an error wrapping
+// ErrKeyNotFound is returned.
+func SoftDeleteJSON(stub shim.ChaincodeStubInterface, key string) error {
 	var b []byte
 	var err error
 	if b, err = stub.GetState(key); err != nil {
@@ -71,60 +308,112 @@ func GetJSON(stub shim.ChaincodeStubInterface, key string, valuePtr interface{})
 		return err
 	}
 
-	if err = json.Unmarshal(b, valuePtr); err != nil {
+	if len(b) == 0 {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		Logger.Error(err.Error())
+		return err
+	}
+
+	// use raw messages so the existing fields are written back unchanged
+	var record map[string]json.RawMessage
+	if err = json.Unmarshal(b, &record); err != nil {
 		Logger.Errorf("error deserialising value of %s as json: %s", b, err.Error())
 		return err
 	}
 
-	return nil
+	if record == nil {
+		record = make(map[string]json.RawMessage)
+	}
+	record[SoftDeleteField] = json.RawMessage("true")
+
+	_, err = PutJSON(stub, key, record)
+	return err
 }
 
-// GetQueryResultForQueryString executes the passed in query string.
-// Result set is built and returned as a byte array containing the JSON results.
-func GetQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+// SetFrozen writes the frozen flag read by the Freezable middleware to the
+// ledger under stateKey.
+func SetFrozen(stub shim.ChaincodeStubInterface, stateKey string, frozen bool) error {
+	return setFlag(stub, stateKey, frozen)
+}
 
-	Logger.Debugf("getQueryResultForQueryString queryString:\n%s\n", queryString)
+// IsFrozen reads the frozen flag used by the Freezable middleware from the
+// ledger under stateKey. The chaincode is not frozen if the flag has not been
+// set.
+func IsFrozen(stub shim.ChaincodeStubInterface, stateKey string) (bool, error) {
+	return getFlag(stub, stateKey)
+}
 
-	resultsIterator, err := stub.GetQueryResult(queryString)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
+// SetInitialized writes the initialized flag read by the RequireInitialized
+// middleware to the ledger under flagKey.
+func SetInitialized(stub shim.ChaincodeStubInterface, flagKey string) error {
+	return setFlag(stub, flagKey, true)
+}
 
-	// buffer is a JSON array containing QueryRecords
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+// IsInitialized reads the initialized flag used by the RequireInitialized
+// middleware from the ledger under flagKey. The chaincode is not initialized
+// if the flag has not been set.
+func IsInitialized(stub shim.ChaincodeStubInterface, flagKey string) (bool, error) {
+	return getFlag(stub, flagKey)
+}
 
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
-		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
+// setFlag writes a boolean flag to the ledger under key as json.
+func setFlag(stub shim.ChaincodeStubInterface, key string, value bool) error {
+	_, err := PutJSON(stub, key, value)
+	return err
+}
+
+// getFlag reads a boolean flag from the ledger under key, which is false if it
+// has not been set.
+func getFlag(stub shim.ChaincodeStubInterface, key string) (bool, error) {
+	var value bool
+	err := GetJSONOrDefault(stub, key, &value, false)
+	return value, err
+}
+
+// EmitEvent marshals the given payload to json and sets it as the event for the
+// transaction. Fabric only supports a single event per transaction, so calling
+// this more than once in a transaction replaces the previous event.
+func EmitEvent(stub shim.ChaincodeStubInterface, name string, payload interface{}) error {
+	// serialise the payload as json
+	var b []byte
+	var err error
+	if b, err = json.Marshal(payload); err != nil {
+		Logger.Error(err.Error())
+		return err
+	}
 
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+	// set the event on the transaction
+	if err = stub.SetEvent(name, b); err != nil {
+		Logger.Errorf("error setting event %s: %s", name, err.Error())
+		return err
 	}
-	buffer.WriteString("]")
 
-	Logger.Debugf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
+	return nil
+}
+
+// DeterministicNow returns the transaction timestamp in UTC, which is the only
+// safe source of the current time in chaincode. The timestamp is set by the
+// client when the transaction is proposed, so it is the same on every peer,
+// whereas time.Now differs between peers and causes endorsements to mismatch.
+func DeterministicNow(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		Logger.Errorf("error getting transaction timestamp: %s", err.Error())
+		return time.Time{}, err
+	}
+	if ts == nil {
+		err = errors.New("transaction timestamp is not set")
+		Logger.Error(err.Error())
+		return time.Time{}, err
+	}
 
-	return buffer.Bytes(), nil
+	return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), nil
 }
 
-// GetCreatorCert gets the certificate of the transactor who initiated this transaction.
-func GetCreatorCert(stub shim.ChaincodeStubInterface) (*x509.Certificate, error) {
+// GetCreatorIdentity gets the serialized identity of the transactor who
+// initiated this transaction, which contains the MSP ID and the PEM encoded
+// certificate of the creator.
+func GetCreatorIdentity(stub shim.ChaincodeStubInterface) (*mspprotos.SerializedIdentity, error) {
 	// get the creator identity from the stub
 	creatorBytes, err := stub.GetCreator()
 	if err != nil {
@@ -139,15 +428,65 @@ func GetCreatorCert(stub shim.ChaincodeStubInterface) (*x509.Certificate, error)
 
 	Logger.Debugf("Creator Identity: %#v", id)
 
+	return &id, nil
+}
+
+// GetCreatorMSPID gets the MSP ID of the transactor who initiated this transaction.
+func GetCreatorMSPID(stub shim.ChaincodeStubInterface) (string, error) {
+	id, err := GetCreatorIdentity(stub)
+	if err != nil {
+		return "", err
+	}
+
+	return id.Mspid, nil
+}
+
+// GetCreatorCert gets the certificate of the transactor who initiated this transaction.
+func GetCreatorCert(stub shim.ChaincodeStubInterface) (*x509.Certificate, error) {
+	id, err := GetCreatorIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	return identityCert(id)
+}
+
+// identityCert parses the certificate in a serialized identity.
+func identityCert(id *mspprotos.SerializedIdentity) (*x509.Certificate, error) {
 	// decode the contents of the .pem file stored in the identity
 	block, _ := pem.Decode(id.IdBytes)
 
 	Logger.Debugf("Pem: %#v", block)
 
+	if block == nil {
+		return nil, errors.New("creator identity does not contain a pem encoded certificate")
+	}
+
 	// parse the contents of the .pem as an x509 cert and return the result
 	return x509.ParseCertificate(block.Bytes)
 }
 
+// GetCreatorIDHash gets a hex encoded SHA-256 hash of the MSP ID and the
+// certificate subject of the transactor who initiated this transaction, in the
+// form "<MSP ID>::<subject>". The hash is the same for every transaction by the
+// same identity, even if its certificate is reissued with the same subject, so
+// it can be used as a ledger key for the identity without storing personal
+// information.
+func GetCreatorIDHash(stub shim.ChaincodeStubInterface) (string, error) {
+	id, err := GetCreatorIdentity(stub)
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := identityCert(id)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(id.Mspid + "::" + cert.Subject.String()))
+	return hex.EncodeToString(hash[:]), nil
+}
+
 // GetCreatorCommonName gets the common name from the certificate of the transactor
 // who initiated this transaction
 func GetCreatorCommonName(stub shim.ChaincodeStubInterface) (string, error) {
@@ -157,4 +496,62 @@ func GetCreatorCommonName(stub shim.ChaincodeStubInterface) (string, error) {
 	}
 
 	return cert.Subject.CommonName, nil
-}
\ No newline at end of file
+}
+
+// GetCreatorSubject gets the subject from the certificate of the transactor who
+// initiated this transaction.
+func GetCreatorSubject(stub shim.ChaincodeStubInterface) (pkix.Name, error) {
+	cert, err := GetCreatorCert(stub)
+	if err != nil {
+		return pkix.Name{}, err
+	}
+
+	return cert.Subject, nil
+}
+
+// GetCreatorOU gets the organizational units from the certificate of the
+// transactor who initiated this transaction.
+func GetCreatorOU(stub shim.ChaincodeStubInterface) ([]string, error) {
+	subject, err := GetCreatorSubject(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	return subject.OrganizationalUnit, nil
+}
+
+// AttributeOID is the object identifier of the certificate extension in which
+// Fabric CA stores attributes, as json of the form {"attrs":{"name":"value"}}.
+var AttributeOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// GetCreatorAttributes gets the Fabric CA attributes from the certificate of
+// the transactor who initiated this transaction. If the certificate has no
+// attributes, an empty map is returned.
+func GetCreatorAttributes(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	cert, err := GetCreatorCert(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(AttributeOID) {
+			continue
+		}
+
+		// the attributes are stored as json in the extension value
+		var attrs struct {
+			Attrs map[string]string `json:"attrs"`
+		}
+		if err = json.Unmarshal(ext.Value, &attrs); err != nil {
+			Logger.Errorf("error deserialising certificate attributes %s as json: %s", ext.Value, err.Error())
+			return nil, err
+		}
+
+		if attrs.Attrs == nil {
+			break
+		}
+		return attrs.Attrs, nil
+	}
+
+	return make(map[string]string), nil
+}
@@ -1,10 +1,22 @@
 package invoke
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
-	// "github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -33,3 +45,345 @@ func TestError(t *testing.T) {
 
 	deepEq(t, fmt.Sprintf("Error(%d, \"%s\")", status, message), expected, actual)
 }
+
+func TestErrorJSON(t *testing.T) {
+	status := int32(404)
+	code := "ASSET_NOT_FOUND"
+	message := "asset \"a\" not found"
+	expected := pb.Response{
+		Status:  status,
+		Payload: []byte(`{"code":"ASSET_NOT_FOUND","message":"asset \"a\" not found"}`),
+		Message: message,
+	}
+	actual := ErrorJSON(status, code, message)
+
+	deepEq(t, fmt.Sprintf("ErrorJSON(%d, %#v, %#v)", status, code, message), expected, actual)
+}
+
+func TestSuccessWithContentType(t *testing.T) {
+	payload := []byte("name,value\na,1\n")
+	expected := pb.Response{
+		Status:  200,
+		Payload: []byte("text/csv\nname,value\na,1\n"),
+	}
+	actual := SuccessWithContentType(200, "text/csv", payload)
+	deepEq(t, "SuccessWithContentType(200, \"text/csv\", payload)", expected, actual)
+
+	contentType, body := SplitContentType(actual.Payload)
+	eq(t, "SplitContentType(payload) content type", "text/csv", contentType)
+	deepEq(t, "SplitContentType(payload) body", payload, body)
+
+	contentType, body = SplitContentType([]byte("no newline"))
+	eq(t, "SplitContentType(\"no newline\") content type", "", contentType)
+	deepEq(t, "SplitContentType(\"no newline\") body", []byte("no newline"), body)
+
+	deepEq(t, "SuccessWithContentType(200, \"text/csv\\n\", payload)",
+		Error(500, `content type "text/csv\n" must not contain a newline`), SuccessWithContentType(200, "text/csv\n", payload))
+}
+
+func TestDeleteJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	key := "key"
+	stub.PutState(key, []byte(`{"name":"a"}`))
+
+	eq(t, fmt.Sprintf("DeleteJSON(stub, \"%s\")", key), nil, DeleteJSON(stub, key))
+	b, _ := stub.GetState(key)
+	eq(t, "len(stub.GetState(key))", 0, len(b))
+}
+
+func TestSoftDeleteJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	key := "key"
+	stub.PutState(key, []byte(`{"name":"a","count":12345678901234567890}`))
+
+	eq(t, fmt.Sprintf("SoftDeleteJSON(stub, \"%s\")", key), nil, SoftDeleteJSON(stub, key))
+	b, _ := stub.GetState(key)
+	eq(t, "stub.GetState(key)", `{"count":12345678901234567890,"deleted":true,"name":"a"}`, string(b))
+
+	err := SoftDeleteJSON(stub, "missing")
+	eq(t, "errors.Is(SoftDeleteJSON(stub, \"missing\"), ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestGetJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("key", []byte(`{"name":"a"}`))
+	stub.PutState("invalid", []byte(`{"name":`))
+
+	var value map[string]string
+	eq(t, "GetJSON(stub, \"key\", &value)", nil, GetJSON(stub, "key", &value))
+	deepEq(t, "value", map[string]string{"name": "a"}, value)
+
+	err := GetJSON(stub, "missing", &value)
+	eq(t, "errors.Is(GetJSON(stub, \"missing\", &value), ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+	eq(t, "GetJSON(stub, \"missing\", &value)", "key not found: missing", err.Error())
+
+	err = GetJSON(stub, "invalid", &value)
+	eq(t, "errors.Is(GetJSON(stub, \"invalid\", &value), ErrKeyNotFound)", false, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestDeterministicNow(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	_, err := DeterministicNow(stub)
+	notNil(t, "DeterministicNow(stub) error without timestamp", err)
+
+	stub.MockTransactionStart("123")
+	ts, _ := stub.GetTxTimestamp()
+	now, err := DeterministicNow(stub)
+	eq(t, "DeterministicNow(stub) error", nil, err)
+	eq(t, "DeterministicNow(stub)", time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), now)
+}
+
+func TestGetCreatorIdentity(t *testing.T) {
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user1", nil))
+	id, err := GetCreatorIdentity(stub)
+	eq(t, "GetCreatorIdentity(stub) error", nil, err)
+	eq(t, "GetCreatorIdentity(stub).Mspid", "Org1MSP", id.Mspid)
+
+	cert, _ := GetCreatorCert(stub)
+	block, _ := pem.Decode(id.IdBytes)
+	deepEq(t, "GetCreatorIdentity(stub).IdBytes", cert.Raw, block.Bytes)
+
+	_, err = GetCreatorIdentity(newCreatorStub([]byte("invalid")))
+	notNil(t, "GetCreatorIdentity(stub) error with invalid creator", err)
+}
+
+func TestGetCreatorIDHash(t *testing.T) {
+	subject := pkix.Name{CommonName: "user1", Organization: []string{"Org1"}}
+	stub := newCreatorStub(newTestIdentityWithSubject(t, "Org1MSP", subject, nil))
+
+	// sha256 of "Org1MSP::CN=user1,O=Org1"
+	hash, err := GetCreatorIDHash(stub)
+	eq(t, "GetCreatorIDHash(stub) error", nil, err)
+	eq(t, "GetCreatorIDHash(stub)", "2741bf3db692d49657f8adcd54cf31914d409e8930133d47553023ef83a0e9ce", hash)
+
+	// a new certificate with the same subject has the same hash
+	stub = newCreatorStub(newTestIdentityWithSubject(t, "Org1MSP", subject, nil))
+	hash, _ = GetCreatorIDHash(stub)
+	eq(t, "GetCreatorIDHash(stub) with reissued certificate", "2741bf3db692d49657f8adcd54cf31914d409e8930133d47553023ef83a0e9ce", hash)
+
+	stub = newCreatorStub(newTestIdentityWithSubject(t, "Org2MSP", subject, nil))
+	hash, _ = GetCreatorIDHash(stub)
+	eq(t, "GetCreatorIDHash(stub) differs by MSP", false, hash == "2741bf3db692d49657f8adcd54cf31914d409e8930133d47553023ef83a0e9ce")
+}
+
+func TestPutJSONT(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	type asset struct {
+		Name  string `json:"name"`
+		Owner string `json:"-"`
+	}
+
+	stored, err := PutJSONT(stub, "key", asset{"a", "b"})
+	eq(t, "PutJSONT(stub, \"key\", ...) error", nil, err)
+	eq(t, "PutJSONT(stub, \"key\", ...)", asset{Name: "a"}, stored)
+	b, _ := stub.GetState("key")
+	eq(t, "stub.GetState(\"key\")", `{"name":"a"}`, string(b))
+}
+
+func TestGetJSONT(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("key", []byte(`{"count":1}`))
+	stub.PutState("invalid", []byte(`{"count":`))
+	type counter struct {
+		Count int `json:"count"`
+	}
+
+	value, found, err := GetJSONT[counter](stub, "key")
+	eq(t, "GetJSONT[counter](stub, \"key\") error", nil, err)
+	eq(t, "GetJSONT[counter](stub, \"key\") found", true, found)
+	eq(t, "GetJSONT[counter](stub, \"key\")", counter{1}, value)
+
+	value, found, err = GetJSONT[counter](stub, "missing")
+	eq(t, "GetJSONT[counter](stub, \"missing\") error", nil, err)
+	eq(t, "GetJSONT[counter](stub, \"missing\") found", false, found)
+	eq(t, "GetJSONT[counter](stub, \"missing\")", counter{}, value)
+
+	_, found, err = GetJSONT[counter](stub, "invalid")
+	notNil(t, "GetJSONT[counter](stub, \"invalid\") error", err)
+	eq(t, "GetJSONT[counter](stub, \"invalid\") found", false, found)
+}
+
+func TestGetJSONOrDefault(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("key", []byte(`{"count":1}`))
+	stub.PutState("invalid", []byte(`{"count":`))
+	type counter struct {
+		Count int `json:"count"`
+	}
+
+	var value counter
+	eq(t, "GetJSONOrDefault(stub, \"key\", ...) error", nil, GetJSONOrDefault(stub, "key", &value, counter{5}))
+	eq(t, "GetJSONOrDefault(stub, \"key\", ...)", counter{1}, value)
+
+	value = counter{}
+	eq(t, "GetJSONOrDefault(stub, \"missing\", ...) error", nil, GetJSONOrDefault(stub, "missing", &value, counter{5}))
+	eq(t, "GetJSONOrDefault(stub, \"missing\", ...)", counter{5}, value)
+
+	value = counter{}
+	err := GetJSONOrDefault(stub, "invalid", &value, counter{5})
+	notNil(t, "GetJSONOrDefault(stub, \"invalid\", ...) error", err)
+	eq(t, "GetJSONOrDefault(stub, \"invalid\", ...)", counter{}, value)
+}
+
+func TestGetMultiJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	stub.PutState("a", []byte(`{"name":"a"}`))
+	stub.PutState("b", []byte(`1`))
+	stub.PutState("invalid", []byte(`{"name":`))
+
+	var a map[string]string
+	var b int
+	eq(t, "GetMultiJSON error", nil, GetMultiJSON(stub, []string{"a", "b"}, []interface{}{&a, &b}))
+	deepEq(t, "GetMultiJSON first value", map[string]string{"name": "a"}, a)
+	eq(t, "GetMultiJSON second value", 1, b)
+
+	err := GetMultiJSON(stub, []string{"a", "missing"}, []interface{}{&a, &b})
+	eq(t, "errors.Is(GetMultiJSON error with missing key, ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+	eq(t, "GetMultiJSON error with missing key", "key not found: missing", err.Error())
+
+	err = GetMultiJSON(stub, []string{"invalid"}, []interface{}{&a})
+	eq(t, "GetMultiJSON error with invalid json", "error getting invalid: unexpected end of JSON input", err.Error())
+
+	notNil(t, "GetMultiJSON error with mismatched lengths", GetMultiJSON(stub, []string{"a"}, nil))
+
+	raw, err := GetMultiRawJSON(stub, []string{"a", "b"})
+	eq(t, "GetMultiRawJSON error", nil, err)
+	deepEq(t, "GetMultiRawJSON", map[string]json.RawMessage{"a": json.RawMessage(`{"name":"a"}`), "b": json.RawMessage(`1`)}, raw)
+
+	_, err = GetMultiRawJSON(stub, []string{"missing"})
+	eq(t, "errors.Is(GetMultiRawJSON error with missing key, ErrKeyNotFound)", true, errors.Is(err, ErrKeyNotFound))
+}
+
+// creatorStub is a mock stub which returns the given creator identity.
+type creatorStub struct {
+	*shim.MockStub
+	creator []byte
+}
+
+func (s creatorStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func newCreatorStub(creator []byte) creatorStub {
+	stub := creatorStub{shim.NewMockStub("test", new(testCC)), creator}
+	stub.MockTransactionStart("123")
+	return stub
+}
+
+// newTestIdentity creates a serialized identity with a self-signed certificate
+// for the given common name, containing the given Fabric CA attributes.
+func newTestIdentity(t *testing.T, mspID string, cn string, attrs map[string]string) []byte {
+	return newTestIdentityWithSubject(t, mspID, pkix.Name{CommonName: cn}, attrs)
+}
+
+// newTestIdentityWithSubject creates a serialized identity with a self-signed
+// certificate for the given subject, containing the given Fabric CA attributes.
+func newTestIdentityWithSubject(t *testing.T, mspID string, subject pkix.Name, attrs map[string]string) []byte {
+	return newTestIdentityFromTemplate(t, mspID, x509.Certificate{
+		Subject:   subject,
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}, attrs)
+}
+
+// newTestIdentityFromTemplate creates a serialized identity with a self-signed
+// certificate created from the template, containing the given Fabric CA attributes.
+func newTestIdentityFromTemplate(t *testing.T, mspID string, template x509.Certificate, attrs map[string]string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(1)
+
+	if attrs != nil {
+		value, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: AttributeOID, Value: value})
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := proto.Marshal(&mspprotos.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestGetCreatorAttributes(t *testing.T) {
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user", map[string]string{"role": "admin"}))
+	attrs, err := GetCreatorAttributes(stub)
+	eq(t, "GetCreatorAttributes error", nil, err)
+	deepEq(t, "GetCreatorAttributes(stub)", map[string]string{"role": "admin"}, attrs)
+
+	stub = newCreatorStub(newTestIdentity(t, "Org1MSP", "user", nil))
+	attrs, err = GetCreatorAttributes(stub)
+	eq(t, "GetCreatorAttributes error", nil, err)
+	deepEq(t, "GetCreatorAttributes(stub)", map[string]string{}, attrs)
+
+	stub = newCreatorStub(nil)
+	if _, err = GetCreatorAttributes(stub); err == nil {
+		t.Errorf("GetCreatorAttributes(stub) with no creator: expected an error but got nil")
+	}
+}
+
+func TestGetCreatorMSPID(t *testing.T) {
+	stub := newCreatorStub(newTestIdentity(t, "Org1MSP", "user", nil))
+	mspID, err := GetCreatorMSPID(stub)
+	eq(t, "GetCreatorMSPID error", nil, err)
+	eq(t, "GetCreatorMSPID(stub)", "Org1MSP", mspID)
+}
+
+func TestGetCreatorSubject(t *testing.T) {
+	stub := newCreatorStub(newTestIdentityWithSubject(t, "Org1MSP", pkix.Name{
+		CommonName:         "user",
+		Organization:       []string{"org1"},
+		OrganizationalUnit: []string{"client", "department1"},
+		Country:            []string{"AU"},
+	}, nil))
+
+	subject, err := GetCreatorSubject(stub)
+	eq(t, "GetCreatorSubject error", nil, err)
+	eq(t, "GetCreatorSubject(stub).CommonName", "user", subject.CommonName)
+	deepEq(t, "GetCreatorSubject(stub).Organization", []string{"org1"}, subject.Organization)
+	deepEq(t, "GetCreatorSubject(stub).Country", []string{"AU"}, subject.Country)
+
+	ou, err := GetCreatorOU(stub)
+	eq(t, "GetCreatorOU error", nil, err)
+	deepEq(t, "GetCreatorOU(stub)", []string{"client", "department1"}, ou)
+}
+
+func TestSplitKeyJSON(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	key, _ := stub.CreateCompositeKey("owner~asset", []string{"alice", "a"})
+
+	for _, k := range []string{key, `"\u0000owner~asset\u0000alice\u0000a\u0000"`} {
+		objectType, attrs, err := SplitKeyJSON(stub, k)
+		eq(t, fmt.Sprintf("SplitKeyJSON(stub, %q) error", k), nil, err)
+		eq(t, fmt.Sprintf("SplitKeyJSON(stub, %q) objectType", k), "owner~asset", objectType)
+		deepEq(t, fmt.Sprintf("SplitKeyJSON(stub, %q) attrs", k), []string{"alice", "a"}, attrs)
+	}
+
+	for _, k := range []string{"", "asset1", "\x00owner~asset\x00alice", "\x00\x00alice\x00", `"\u0000owner`, "\x00"} {
+		_, _, err := SplitKeyJSON(stub, k)
+		eq(t, fmt.Sprintf("errors.Is(SplitKeyJSON(stub, %q), ErrInvalidCompositeKey)", k), true, errors.Is(err, ErrInvalidCompositeKey))
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ArgRule is a validation rule for the argument at Index. Custom rules can be
+// created by providing a Name, used in error messages, and a Check function
+// which returns whether the argument is valid.
+type ArgRule struct {
+	Index int
+	Name  string
+	Check func(arg string) bool
+}
+
+var (
+	numericRegexp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	uuidRegexp    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// ArgNonEmpty returns a rule checking the argument is not an empty string.
+func ArgNonEmpty(index int) ArgRule {
+	return ArgRule{index, "non-empty", func(arg string) bool {
+		return arg != ""
+	}}
+}
+
+// ArgNumeric returns a rule checking the argument is a decimal number, such as
+// "12" or "-1.5".
+func ArgNumeric(index int) ArgRule {
+	return ArgRule{index, "numeric", numericRegexp.MatchString}
+}
+
+// ArgUUID returns a rule checking the argument is a UUID in its canonical
+// hyphenated form.
+func ArgUUID(index int) ArgRule {
+	return ArgRule{index, "uuid", uuidRegexp.MatchString}
+}
+
+// ArgMatches returns a rule checking the argument matches the regular expression.
+func ArgMatches(index int, re *regexp.Regexp) ArgRule {
+	return ArgRule{index, fmt.Sprintf("matches %s", re), re.MatchString}
+}
+
+// ArgJSON returns a rule checking the argument is valid json.
+func ArgJSON(index int) ArgRule {
+	return ArgRule{index, "json", func(arg string) bool {
+		return json.Valid([]byte(arg))
+	}}
+}
+
+// ValidateArgs creates a middleware that checks the arguments against each of
+// the rules, and returns a 400 error listing every rule which failed.
+func ValidateArgs(rules ...ArgRule) Middleware {
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		failures := make([]string, 0)
+		for _, rule := range rules {
+			if rule.Index >= len(args) {
+				failures = append(failures, fmt.Sprintf("argument %d is missing (%s)", rule.Index, rule.Name))
+			} else if !rule.Check(args[rule.Index]) {
+				failures = append(failures, fmt.Sprintf("argument %d failed rule %s", rule.Index, rule.Name))
+			}
+		}
+
+		if len(failures) > 0 {
+			err := fmt.Sprintf("invalid arguments: %s", strings.Join(failures, "; "))
+			Logger.Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// JSONSchemaValidator creates a middleware that validates the json in the
+// specified argument position against a draft-07 JSON Schema, and returns a 400
+// error listing the validation errors if it does not conform. The schema is
+// compiled once when the middleware is created, and JSONSchemaValidator panics
+// if the schema is invalid.
+func JSONSchemaValidator(argIndex int, schema string) Middleware {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	if err := compiler.AddResource("schema.json", strings.NewReader(schema)); err != nil {
+		panic(fmt.Sprintf("invalid json schema: %s", err.Error()))
+	}
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		panic(fmt.Sprintf("invalid json schema: %s", err.Error()))
+	}
+
+	return func(stub shim.ChaincodeStubInterface, args []string, next Handler) pb.Response {
+		// check index is valid
+		if argIndex >= len(args) {
+			err := fmt.Sprintf("argIndex %d was greater than length of args", argIndex)
+			Logger.Error(err)
+			return Error(http.StatusInternalServerError, fmt.Sprintf("error validating json: %s", err))
+		}
+
+		// decode the argument, keeping numbers exact for the validator
+		decoder := json.NewDecoder(strings.NewReader(args[argIndex]))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			Logger.Error(err)
+			return Error(http.StatusBadRequest, fmt.Sprintf("error unmarshalling json: %s", err.Error()))
+		}
+
+		if err := compiled.Validate(value); err != nil {
+			var validationErr *jsonschema.ValidationError
+			if !errors.As(err, &validationErr) {
+				Logger.Error(err)
+				return Error(http.StatusInternalServerError, fmt.Sprintf("error validating json: %s", err.Error()))
+			}
+
+			// the order of the errors is not stable, so sort them to keep the
+			// response deterministic across peers
+			errs := schemaErrors(validationErr)
+			sort.Strings(errs)
+
+			err := fmt.Sprintf("json does not match schema: %s", strings.Join(errs, "; "))
+			Logger.Error(err)
+			return Error(http.StatusBadRequest, err)
+		}
+
+		// call next handler
+		return next(stub, args)
+	}
+}
+
+// schemaErrors lists the leaf errors of a schema validation error, which are
+// the errors describing each specific problem with the value.
+func schemaErrors(validationErr *jsonschema.ValidationError) []string {
+	if len(validationErr.Causes) == 0 {
+		location := validationErr.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", location, validationErr.Message)}
+	}
+
+	errs := make([]string, 0, len(validationErr.Causes))
+	for _, cause := range validationErr.Causes {
+		errs = append(errs, schemaErrors(cause)...)
+	}
+
+	return errs
+}
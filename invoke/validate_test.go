@@ -0,0 +1,98 @@
+package invoke
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var argRuleTests = []struct {
+	rule     ArgRule
+	arg      string
+	expected bool
+}{
+	{ArgNonEmpty(0), "a", true},
+	{ArgNonEmpty(0), "", false},
+	{ArgNumeric(0), "12", true},
+	{ArgNumeric(0), "-1.5", true},
+	{ArgNumeric(0), "1e5", false},
+	{ArgNumeric(0), "NaN", false},
+	{ArgUUID(0), "123e4567-e89b-12d3-a456-426614174000", true},
+	{ArgUUID(0), "123e4567e89b12d3a456426614174000", false},
+	{ArgMatches(0, regexp.MustCompile(`^asset-[0-9]+$`)), "asset-1", true},
+	{ArgMatches(0, regexp.MustCompile(`^asset-[0-9]+$`)), "asset-a", false},
+	{ArgJSON(0), `{"name":"a"}`, true},
+	{ArgJSON(0), `{"name":`, false},
+}
+
+func TestArgRules(t *testing.T) {
+	for _, v := range argRuleTests {
+		eq(t, fmt.Sprintf("%s rule on %#v", v.rule.Name, v.arg), v.expected, v.rule.Check(v.arg))
+	}
+}
+
+var validateArgsTests = []struct {
+	args        []string
+	expectedRsp pb.Response
+}{
+	{[]string{"a", "12"}, Success(200, nil)},
+	{[]string{"", "12"}, Error(400, "invalid arguments: argument 0 failed rule non-empty")},
+	{[]string{"", "a"}, Error(400, "invalid arguments: argument 0 failed rule non-empty; argument 1 failed rule numeric")},
+	{[]string{"a"}, Error(400, "invalid arguments: argument 1 is missing (numeric)")},
+}
+
+func TestValidateArgs(t *testing.T) {
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	h = h.use(ValidateArgs(ArgNonEmpty(0), ArgNumeric(1)))
+
+	for _, v := range validateArgsTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		deepEq(t, fmt.Sprintf("ValidateArgs response for %#v", v.args), v.expectedRsp, h(stub, v.args))
+	}
+}
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"count": {"type": "integer", "minimum": 0}
+	},
+	"required": ["name"]
+}`
+
+var jsonSchemaValidatorTests = []struct {
+	args        []string
+	expectedRsp pb.Response
+}{
+	{[]string{`{"name":"a","count":1}`}, Success(200, nil)},
+	{[]string{`{"count":1}`}, Error(400, "json does not match schema: /: missing properties: 'name'")},
+	{[]string{`{"name":1,"count":-1}`}, Error(400, "json does not match schema: /count: must be >= 0 but found -1; /name: expected string, but got number")},
+	{[]string{`{"name":`}, Error(400, "error unmarshalling json: unexpected EOF")},
+	{[]string{}, Error(500, "error validating json: argIndex 0 was greater than length of args")},
+}
+
+func TestJSONSchemaValidator(t *testing.T) {
+	h := Handler(func(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return Success(200, nil)
+	})
+	h = h.use(JSONSchemaValidator(0, testSchema))
+
+	for _, v := range jsonSchemaValidatorTests {
+		stub := shim.NewMockStub("test", new(testCC))
+		deepEq(t, fmt.Sprintf("JSONSchemaValidator response for %#v", v.args), v.expectedRsp, h(stub, v.args))
+	}
+}
+
+func TestJSONSchemaValidatorInvalidSchema(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("JSONSchemaValidator with an invalid schema did not panic")
+		}
+	}()
+	JSONSchemaValidator(0, `{"type": 1}`)
+}
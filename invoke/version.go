@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2017 All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		 http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package invoke
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// VersionField is the field of json records which PutJSONIfVersion uses to
+// store the version of the record.
+var VersionField = "version"
+
+// ErrVersionConflict is wrapped by the error returned by PutJSONIfVersion when
+// the stored version is not the expected version, so it can be checked for
+// with errors.Is.
+var ErrVersionConflict = errors.New("version conflict")
+
+// PutJSONIfVersion writes the value to the ledger as json, like PutJSON, but
+// only if the version stored in the VersionField of the existing record is
+// expectedVersion. A record which does not exist has version 0. The value is
+// written with VersionField set to the next version, which is returned, so the
+// value must marshal to a json object. If the stored version is different, an
+// InvokeError with a 409 status wrapping ErrVersionConflict is returned, and
+// nothing is written.
+//
+// Fabric's MVCC validation already rejects a transaction at commit if a key it
+// read was changed by an earlier transaction, but only once the client has
+// submitted it for ordering. An explicit version lets a handler detect that a
+// client's update is based on a stale read while the transaction is being
+// simulated, and return a clean 409 the client can act on.
+func PutJSONIfVersion(stub shim.ChaincodeStubInterface, key string, value interface{}, expectedVersion int) (int, error) {
+	current, err := getJSONVersion(stub, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if current != expectedVersion {
+		err = NewInvokeError(http.StatusConflict, fmt.Sprintf("%s: %s is at version %d, expected version %d", ErrVersionConflict.Error(), key, current, expectedVersion), ErrVersionConflict)
+		Logger.Error(err.Error())
+		return 0, err
+	}
+
+	// use raw messages so the fields of the value are written unchanged
+	b, err := json.Marshal(value)
+	if err != nil {
+		Logger.Errorf("error serialising %s as json: %s", key, err.Error())
+		return 0, err
+	}
+	var record map[string]json.RawMessage
+	if err = json.Unmarshal(b, &record); err != nil {
+		Logger.Errorf("error serialising %s as a json object: %s", key, err.Error())
+		return 0, err
+	}
+
+	if record == nil {
+		record = make(map[string]json.RawMessage)
+	}
+	next := current + 1
+	record[VersionField] = json.RawMessage(strconv.Itoa(next))
+
+	if _, err = PutJSON(stub, key, record); err != nil {
+		return 0, err
+	}
+
+	return next, nil
+}
+
+// getJSONVersion gets the version stored in the VersionField of the json record
+// under key, or 0 if the record or the field does not exist.
+func getJSONVersion(stub shim.ChaincodeStubInterface, key string) (int, error) {
+	b, err := stub.GetState(key)
+	if err != nil {
+		Logger.Errorf("error getting state of %s from ledger: %s", key, err.Error())
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var record map[string]json.RawMessage
+	if err = json.Unmarshal(b, &record); err != nil {
+		Logger.Errorf("error deserialising value of %s as json: %s", key, err.Error())
+		return 0, err
+	}
+
+	raw, ok := record[VersionField]
+	if !ok {
+		return 0, nil
+	}
+
+	var version int
+	if err = json.Unmarshal(raw, &version); err != nil {
+		Logger.Errorf("error deserialising %s of %s as an integer: %s", VersionField, key, err.Error())
+		return 0, err
+	}
+
+	return version, nil
+}
@@ -0,0 +1,44 @@
+package invoke
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPutJSONIfVersion(t *testing.T) {
+	stub := shim.NewMockStub("test", new(testCC))
+	stub.MockTransactionStart("123")
+	type asset struct {
+		Name    string `json:"name"`
+		Version int    `json:"version"`
+	}
+
+	version, err := PutJSONIfVersion(stub, "key", asset{Name: "a"}, 0)
+	eq(t, "PutJSONIfVersion error creating record", nil, err)
+	eq(t, "PutJSONIfVersion version creating record", 1, version)
+	b, _ := stub.GetState("key")
+	eq(t, "stored record", `{"name":"a","version":1}`, string(b))
+
+	version, err = PutJSONIfVersion(stub, "key", asset{Name: "b"}, 1)
+	eq(t, "PutJSONIfVersion error updating record", nil, err)
+	eq(t, "PutJSONIfVersion version updating record", 2, version)
+	b, _ = stub.GetState("key")
+	eq(t, "stored record", `{"name":"b","version":2}`, string(b))
+
+	_, err = PutJSONIfVersion(stub, "key", asset{Name: "c"}, 1)
+	eq(t, "errors.Is(PutJSONIfVersion error with stale version, ErrVersionConflict)", true, errors.Is(err, ErrVersionConflict))
+	deepEq(t, "ErrorFrom(PutJSONIfVersion error with stale version)", Error(409, "version conflict: key is at version 2, expected version 1"), ErrorFrom(err))
+	b, _ = stub.GetState("key")
+	eq(t, "stored record after conflict", `{"name":"b","version":2}`, string(b))
+
+	// records written without a version have version 0
+	stub.PutState("unversioned", []byte(`{"name":"a"}`))
+	version, err = PutJSONIfVersion(stub, "unversioned", asset{Name: "b"}, 0)
+	eq(t, "PutJSONIfVersion error updating unversioned record", nil, err)
+	eq(t, "PutJSONIfVersion version updating unversioned record", 1, version)
+
+	_, err = PutJSONIfVersion(stub, "array", []string{"a"}, 0)
+	notNil(t, "PutJSONIfVersion error with array value", err)
+}